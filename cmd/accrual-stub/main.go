@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/accrualstub"
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func main() {
+	logger.NewLogger()
+
+	addr := flag.String("a", ":8081", "stub server address")
+	script := flag.String("script", "REGISTERED,PROCESSING,PROCESSED", "comma separated status progression per order")
+	accrualMin := flag.Float64("accrual", 500, "accrual for PROCESSED orders, or the lower bound when -accrual-max is set")
+	accrualMax := flag.Float64("accrual-max", 0, "upper bound for random accruals")
+	unknownFor := flag.Int("unknown-for", 0, "number of requests per order answered with 204 before the script starts")
+	unknownOrders := flag.String("unknown", "", "comma separated orders always answered with 204")
+	invalidOrders := flag.String("invalid", "", "comma separated orders always answered as INVALID")
+	rateLimit := flag.Int("rate-limit", 0, "requests per minute before 429 is returned, 0 disables it")
+	retryAfter := flag.Duration("retry-after", time.Minute, "Retry-After sent with 429")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	jitter := flag.Duration("jitter", 0, "random extra delay added on top of -latency")
+	errorRate := flag.Float64("error-rate", 0, "share of requests answered with 500, from 0 to 1")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed for reproducible runs")
+
+	flag.Parse()
+
+	if value := os.Getenv("RUN_ADDRESS"); len(value) > 0 {
+		*addr = value
+	}
+
+	statuses, err := parseScript(*script)
+	if err != nil {
+		logger.Infof("accrual stub -script: %v", err)
+
+		os.Exit(1)
+	}
+
+	max := *accrualMax
+	if max < *accrualMin {
+		max = *accrualMin
+	}
+
+	server := accrualstub.New(accrualstub.Config{
+		Script:        statuses,
+		AccrualMin:    *accrualMin,
+		AccrualMax:    max,
+		UnknownFor:    *unknownFor,
+		UnknownOrders: toSet(splitList(*unknownOrders)),
+		InvalidOrders: toSet(splitList(*invalidOrders)),
+		RateLimit:     *rateLimit,
+		RetryAfter:    *retryAfter,
+		Latency:       *latency,
+		Jitter:        *jitter,
+		ErrorRate:     *errorRate,
+		Seed:          *seed,
+	})
+
+	logger.Infof("starting the accrual stub at %s", *addr)
+
+	err = server.Router().Run(*addr)
+	if err != nil {
+		logger.Infof("accrual stub starting err: %v", err)
+
+		os.Exit(1)
+	}
+}
+
+// parseScript accepts only the statuses the accrual system answers with, NEW
+// is a gophermart status.
+func parseScript(value string) ([]models.OrderStatus, error) {
+	statuses := make([]models.OrderStatus, 0)
+	for _, item := range splitList(value) {
+		status := models.OrderStatus(strings.ToUpper(item))
+		if !status.Valid() || status == models.NEW {
+			return nil, fmt.Errorf("unknown accrual status %q, use REGISTERED, PROCESSING, INVALID or PROCESSED", item)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+
+	return set
+}
@@ -4,7 +4,10 @@ import (
 	"flag"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/vtcaregorodtcev/gophermarket/internal/app"
 	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
@@ -16,13 +19,123 @@ func main() {
 	logger.Infof("starting the GopherMart server...")
 
 	poolCount := 4 // calc core threads size...
+	pollInterval := time.Second * 5
+	pollBatch := 100
+	recoveryBatch := helpers.GetStringEnv("ACCRUAL_RECOVERY_BATCH", flag.String("recovery-batch", "500", "max orders re-enqueued per startup recovery batch"))
+	unknownGrace := helpers.GetStringEnv("ACCRUAL_UNKNOWN_GRACE", flag.String("unknown-grace", "10m", "how long to retry orders unknown to accrual system"))
 	addr := helpers.GetStringEnv("RUN_ADDRESS", flag.String("a", "", "server address"))
 	accrualAddr := helpers.GetStringEnv("ACCRUAL_SYSTEM_ADDRESS", flag.String("r", "", "accrual service address"))
+	accrualMode := helpers.GetStringEnv("ACCRUAL_MODE", flag.String("accrual-mode", "external", "accrual mode: external or builtin"))
+	accrualTimeout := helpers.GetStringEnv("ACCRUAL_TIMEOUT", flag.String("accrual-timeout", "10s", "timeout of a single accrual request"))
+	accrualIdleConns := helpers.GetStringEnv("ACCRUAL_MAX_IDLE_CONNS", flag.String("accrual-idle-conns", "16", "max idle connections to accrual service"))
+	accrualCA := helpers.GetStringEnv("ACCRUAL_CA_FILE", flag.String("accrual-ca", "", "PEM CA bundle to trust for accrual service"))
+	accrualCert := helpers.GetStringEnv("ACCRUAL_CERT_FILE", flag.String("accrual-cert", "", "client certificate for accrual service mTLS"))
+	accrualKey := helpers.GetStringEnv("ACCRUAL_KEY_FILE", flag.String("accrual-key", "", "client key for accrual service mTLS"))
+	accrualAuth := helpers.GetStringEnv("ACCRUAL_AUTH_HEADER", flag.String("accrual-auth", "", "auth header for accrual service, e.g. \"Authorization: Bearer xxx\""))
 	dbURI := helpers.GetStringEnv("DATABASE_URI", flag.String("d", "", "db connection string"))
+	jwtSecret := helpers.GetStringEnv("JWT_SECRET", flag.String("jwt-secret", "", "HS256 secret for signing tokens, at least 32 bytes"))
+	jwtKeys := helpers.GetStringEnv("JWT_KEYS_FILE", flag.String("jwt-keys", "", "JSON file with rotatable jwt signing keys"))
+	loginStore := helpers.GetStringEnv("LOGIN_ATTEMPTS_STORE", flag.String("login-store", "memory", "failed login counters store: memory or postgres"))
+	loginMaxFailures := helpers.GetStringEnv("LOGIN_MAX_FAILURES", flag.String("login-max-failures", "10", "failed logins before an account is locked"))
+	loginLockout := helpers.GetStringEnv("LOGIN_LOCKOUT", flag.String("login-lockout", "15m", "how long an account stays locked"))
+	passwordMinLength := helpers.GetStringEnv("PASSWORD_MIN_LENGTH", flag.String("password-min-length", "8", "minimum password length"))
+	passwordMinClasses := helpers.GetStringEnv("PASSWORD_MIN_CLASSES", flag.String("password-min-classes", "2", "how many of lowercase, uppercase, digits and symbols a password must mix"))
+	adminLogins := helpers.GetStringEnv("ADMIN_LOGINS", flag.String("admin-logins", "", "comma separated logins granted the admin role on startup"))
+	trustedProxies := helpers.GetStringEnv("TRUSTED_PROXIES", flag.String("trusted-proxies", "", "comma separated proxy addresses or CIDRs allowed to set X-Forwarded-For"))
+	reconcileInterval := helpers.GetStringEnv("RECONCILE_INTERVAL", flag.String("reconcile-interval", "1h", "how often balances are checked against the ledger, 0 disables"))
 
 	flag.Parse()
 
-	app, err := app.New(app.Config{Addr: *addr, DatabaseURI: *dbURI, AccrualAddr: *accrualAddr, PoolCount: poolCount})
+	grace, err := time.ParseDuration(*unknownGrace)
+	if err != nil {
+		logger.Infof("invalid unknown grace period: %v", err)
+
+		os.Exit(1)
+	}
+
+	batch, err := strconv.Atoi(*recoveryBatch)
+	if err != nil || batch <= 0 {
+		logger.Infof("invalid recovery batch size: %s", *recoveryBatch)
+
+		os.Exit(1)
+	}
+
+	timeout, err := time.ParseDuration(*accrualTimeout)
+	if err != nil {
+		logger.Infof("invalid accrual timeout: %v", err)
+
+		os.Exit(1)
+	}
+
+	idleConns, err := strconv.Atoi(*accrualIdleConns)
+	if err != nil {
+		logger.Infof("invalid accrual idle connections: %v", err)
+
+		os.Exit(1)
+	}
+
+	maxFailures, err := strconv.Atoi(*loginMaxFailures)
+	if err != nil || maxFailures <= 0 {
+		logger.Infof("invalid login max failures: %s", *loginMaxFailures)
+
+		os.Exit(1)
+	}
+
+	lockout, err := time.ParseDuration(*loginLockout)
+	if err != nil {
+		logger.Infof("invalid login lockout: %v", err)
+
+		os.Exit(1)
+	}
+
+	minLength, err := strconv.Atoi(*passwordMinLength)
+	if err != nil || minLength <= 0 {
+		logger.Infof("invalid password min length: %s", *passwordMinLength)
+
+		os.Exit(1)
+	}
+
+	minClasses, err := strconv.Atoi(*passwordMinClasses)
+	if err != nil || minClasses < 0 || minClasses > 4 {
+		logger.Infof("invalid password min classes: %s", *passwordMinClasses)
+
+		os.Exit(1)
+	}
+
+	reconcile, err := time.ParseDuration(*reconcileInterval)
+	if err != nil || reconcile < 0 {
+		logger.Infof("invalid reconcile interval: %s", *reconcileInterval)
+
+		os.Exit(1)
+	}
+
+	app, err := app.New(app.Config{
+		Addr:                *addr,
+		DatabaseURI:         *dbURI,
+		AccrualAddr:         *accrualAddr,
+		PoolCount:           poolCount,
+		PollInterval:        pollInterval,
+		PollBatch:           pollBatch,
+		UnknownGrace:        grace,
+		RecoveryBatch:       batch,
+		AccrualMode:         *accrualMode,
+		AccrualTimeout:      timeout,
+		AccrualMaxIdleConns: idleConns,
+		AccrualCAFile:       *accrualCA,
+		AccrualCertFile:     *accrualCert,
+		AccrualKeyFile:      *accrualKey,
+		AccrualAuthHeader:   *accrualAuth,
+		JWTSecret:           *jwtSecret,
+		JWTKeysFile:         *jwtKeys,
+		LoginAttemptsStore:  *loginStore,
+		LoginMaxFailures:    maxFailures,
+		LoginLockout:        lockout,
+		PasswordMinLength:   minLength,
+		PasswordMinClasses:  minClasses,
+		AdminLogins:         splitList(*adminLogins),
+		ReconcileInterval:   reconcile,
+		TrustedProxies:      splitList(*trustedProxies),
+	})
 	if err != nil {
 		logger.Infof("app initialization failed: %v", err)
 
@@ -38,3 +151,14 @@ func main() {
 	<-interrupt
 	logger.Infof("received interrupt signal. shutting down...")
 }
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,174 @@
+package accrualstub
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type Config struct {
+	// Script is the status progression every order goes through, one step
+	// per request. The last status is repeated once reached.
+	Script []models.OrderStatus
+	// AccrualMin and AccrualMax bound the amount returned for PROCESSED
+	// orders. Equal values give a fixed amount.
+	AccrualMin float64
+	AccrualMax float64
+	// UnknownFor is how many requests per order answer 204 before the
+	// script starts.
+	UnknownFor int
+	// UnknownOrders always answer 204, InvalidOrders are always INVALID.
+	UnknownOrders map[string]bool
+	InvalidOrders map[string]bool
+	// RateLimit is the number of requests per minute before 429 is
+	// returned, 0 disables it.
+	RateLimit  int
+	RetryAfter time.Duration
+	Latency    time.Duration
+	Jitter     time.Duration
+	// ErrorRate is the share of requests answered with 500.
+	ErrorRate float64
+	Seed      int64
+}
+
+type response struct {
+	Order   string             `json:"order"`
+	Status  models.OrderStatus `json:"status"`
+	Accrual *float64           `json:"accrual,omitempty"`
+}
+
+type Server struct {
+	cfg Config
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	requests map[string]int
+	accruals map[string]float64
+
+	windowStart time.Time
+	windowCount int
+}
+
+func New(cfg Config) *Server {
+	if len(cfg.Script) == 0 {
+		cfg.Script = []models.OrderStatus{models.REGISTERED, models.PROCESSING, models.PROCESSED}
+	}
+
+	return &Server{
+		cfg:      cfg,
+		rnd:      rand.New(rand.NewSource(cfg.Seed)),
+		requests: make(map[string]int),
+		accruals: make(map[string]float64),
+	}
+}
+
+func (s *Server) Router() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/api/orders/:number", s.GetOrder)
+
+	return router
+}
+
+func (s *Server) GetOrder(c *gin.Context) {
+	number := c.Param("number")
+
+	if delay := s.delay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rateLimited() {
+		c.Header("Retry-After", strconv.Itoa(int(s.cfg.RetryAfter.Seconds())))
+		c.String(http.StatusTooManyRequests, fmt.Sprintf("No more than %d requests per minute allowed", s.cfg.RateLimit))
+		return
+	}
+
+	if s.cfg.ErrorRate > 0 && s.rnd.Float64() < s.cfg.ErrorRate {
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if s.cfg.UnknownOrders[number] {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	n := s.requests[number]
+	s.requests[number] = n + 1
+
+	if n < s.cfg.UnknownFor {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if s.cfg.InvalidOrders[number] {
+		c.JSON(http.StatusOK, response{Order: number, Status: models.INVALID})
+		return
+	}
+
+	step := n - s.cfg.UnknownFor
+	if step >= len(s.cfg.Script) {
+		step = len(s.cfg.Script) - 1
+	}
+
+	resp := response{Order: number, Status: s.cfg.Script[step]}
+	if resp.Status == models.PROCESSED {
+		accrual := s.accrual(number)
+		resp.Accrual = &accrual
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) delay() time.Duration {
+	if s.cfg.Jitter <= 0 {
+		return s.cfg.Latency
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cfg.Latency + time.Duration(s.rnd.Int63n(int64(s.cfg.Jitter)))
+}
+
+func (s *Server) rateLimited() bool {
+	if s.cfg.RateLimit <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+
+	s.windowCount++
+
+	return s.windowCount > s.cfg.RateLimit
+}
+
+func (s *Server) accrual(number string) float64 {
+	if accrual, ok := s.accruals[number]; ok {
+		return accrual
+	}
+
+	accrual := s.cfg.AccrualMin
+	if s.cfg.AccrualMax > s.cfg.AccrualMin {
+		accrual += s.rnd.Float64() * (s.cfg.AccrualMax - s.cfg.AccrualMin)
+	}
+	accrual = float64(int64(accrual*100)) / 100
+
+	s.accruals[number] = accrual
+
+	return accrual
+}
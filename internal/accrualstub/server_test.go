@@ -0,0 +1,92 @@
+package accrualstub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestServer_GetOrder(t *testing.T) {
+	type step struct {
+		order        string
+		expectedCode int
+		expectedBody string
+	}
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		steps []step
+	}{
+		{
+			name: "Scripted progression with fixed accrual",
+			cfg:  Config{AccrualMin: 500, AccrualMax: 500},
+			steps: []step{
+				{order: "123", expectedCode: http.StatusOK, expectedBody: `{"order":"123","status":"REGISTERED"}`},
+				{order: "123", expectedCode: http.StatusOK, expectedBody: `{"order":"123","status":"PROCESSING"}`},
+				{order: "123", expectedCode: http.StatusOK, expectedBody: `{"order":"123","status":"PROCESSED","accrual":500}`},
+				{order: "123", expectedCode: http.StatusOK, expectedBody: `{"order":"123","status":"PROCESSED","accrual":500}`},
+			},
+		},
+		{
+			name: "Unknown before registration",
+			cfg:  Config{Script: []models.OrderStatus{models.PROCESSED}, AccrualMin: 10, AccrualMax: 10, UnknownFor: 1},
+			steps: []step{
+				{order: "123", expectedCode: http.StatusNoContent},
+				{order: "123", expectedCode: http.StatusOK, expectedBody: `{"order":"123","status":"PROCESSED","accrual":10}`},
+			},
+		},
+		{
+			name: "Invalid and unknown orders",
+			cfg:  Config{InvalidOrders: map[string]bool{"1": true}, UnknownOrders: map[string]bool{"2": true}},
+			steps: []step{
+				{order: "1", expectedCode: http.StatusOK, expectedBody: `{"order":"1","status":"INVALID"}`},
+				{order: "2", expectedCode: http.StatusNoContent},
+			},
+		},
+		{
+			name: "Rate limit",
+			cfg:  Config{Script: []models.OrderStatus{models.PROCESSING}, RateLimit: 1, RetryAfter: time.Minute},
+			steps: []step{
+				{order: "1", expectedCode: http.StatusOK, expectedBody: `{"order":"1","status":"PROCESSING"}`},
+				{order: "1", expectedCode: http.StatusTooManyRequests, expectedBody: "No more than 1 requests per minute allowed"},
+			},
+		},
+		{
+			name: "Error injection",
+			cfg:  Config{ErrorRate: 1},
+			steps: []step{
+				{order: "1", expectedCode: http.StatusInternalServerError, expectedBody: "Internal server error"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := New(tt.cfg).Router()
+
+			for _, s := range tt.steps {
+				req, _ := http.NewRequest("GET", "/api/orders/"+s.order, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, s.expectedCode, w.Code)
+				if w.Header().Get("Content-Type") == "application/json; charset=utf-8" {
+					assert.JSONEq(t, s.expectedBody, w.Body.String())
+				} else {
+					assert.Equal(t, s.expectedBody, w.Body.String())
+				}
+
+				if s.expectedCode == http.StatusTooManyRequests {
+					assert.Equal(t, "60", w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
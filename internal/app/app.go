@@ -1,40 +1,148 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gammazero/workerpool"
 	"github.com/gin-gonic/gin"
 
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/handlers"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/poller"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
 	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+const (
+	AccrualModeExternal = "external"
+	AccrualModeBuiltin  = "builtin"
+
+	LoginAttemptsMemory   = "memory"
+	LoginAttemptsPostgres = "postgres"
 )
 
 type Config struct {
-	AccrualAddr string
-	DatabaseURI string
-	Addr        string
-	PoolCount   int
+	AccrualAddr   string
+	DatabaseURI   string
+	Addr          string
+	PoolCount     int
+	PollInterval  time.Duration
+	PollBatch     int
+	UnknownGrace  time.Duration
+	RecoveryBatch int
+	// AccrualMode is "external" to call the accrual system at AccrualAddr or
+	// "builtin" to compute accruals from reward rules stored in the database.
+	AccrualMode         string
+	AccrualTimeout      time.Duration
+	AccrualMaxIdleConns int
+	AccrualCAFile       string
+	AccrualCertFile     string
+	AccrualKeyFile      string
+	// AccrualAuthHeader is sent with every accrual request, in the
+	// "Name: value" form.
+	AccrualAuthHeader string
+	// JWTKeysFile takes precedence over JWTSecret. Without both a random
+	// secret is generated and tokens don't survive restarts.
+	JWTSecret   string
+	JWTKeysFile string
+	// LoginAttemptsStore is "memory" for a single instance or "postgres"
+	// when failed login counters have to be shared between instances.
+	LoginAttemptsStore string
+	LoginMaxFailures   int
+	LoginLockout       time.Duration
+	PasswordMinLength  int
+	PasswordMinClasses int
+	// AdminLogins are granted the admin role on startup so the first admin
+	// doesn't have to be created by hand in the database.
+	AdminLogins []string
+	// ReconcileInterval is how often cached balances are checked against
+	// the ledger. Zero disables the periodic check.
+	ReconcileInterval time.Duration
+	// TrustedProxies are the addresses or CIDRs allowed to set the client IP
+	// through X-Forwarded-For. Empty trusts none and uses the peer address.
+	TrustedProxies []string
 }
 
 type App struct {
 	cfg            Config
 	router         *gin.Engine
 	storage        storage.Storager
-	accrualService *services.AccrualService
+	accrualService services.Accrualer
 	pool           *workerpool.WorkerPool
+	poller         *poller.Poller
+	reconciler     *services.Reconciler
+	loginLimiter   *services.LoginLimiter
 }
 
 func New(cfg Config) (*App, error) {
+	err := setupJWTKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	helpers.SetPasswordPolicy(helpers.PasswordPolicy{
+		MinLength:  cfg.PasswordMinLength,
+		MinClasses: cfg.PasswordMinClasses,
+	})
+
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
 	storage, err := storage.New(cfg.DatabaseURI)
 	if err != nil {
 		return nil, err
 	}
 
 	wp := workerpool.New(cfg.PoolCount)
-	as := services.NewAccrualService(cfg.AccrualAddr)
+
+	var as services.Accrualer
+	switch cfg.AccrualMode {
+	case AccrualModeBuiltin:
+		logger.Infof("using builtin reward rules accrual engine")
+		as = services.NewRewardEngine(storage)
+	case AccrualModeExternal, "":
+		as, err = services.NewAccrualService(cfg.AccrualAddr, accrualOptions(cfg)...)
+		if err != nil {
+			_ = storage.Close()
+			return nil, err
+		}
+	default:
+		_ = storage.Close()
+		return nil, fmt.Errorf("unknown accrual mode: %s", cfg.AccrualMode)
+	}
+
+	bootstrapAdmins(cfg, storage)
+
+	ll, err := newLoginLimiter(cfg, storage)
+	if err != nil {
+		_ = storage.Close()
+		return nil, err
+	}
+
+	p := poller.New(poller.Config{
+		Interval:      cfg.PollInterval,
+		BatchSize:     cfg.PollBatch,
+		Timeout:       time.Second * 20,
+		Lease:         time.Minute,
+		MaxBackoff:    time.Minute * 5,
+		UnknownGrace:  cfg.UnknownGrace,
+		RecoveryBatch: cfg.RecoveryBatch,
+		RecoveryPause: time.Second * 10,
+	}, storage, as, wp)
+
+	var rc *services.Reconciler
+	if cfg.ReconcileInterval > 0 {
+		rc = services.NewReconciler(storage, cfg.ReconcileInterval)
+	}
 
 	app := &App{
 		cfg:            cfg,
@@ -42,26 +150,170 @@ func New(cfg Config) (*App, error) {
 		storage:        storage,
 		accrualService: as,
 		pool:           wp,
+		poller:         p,
+		reconciler:     rc,
+		loginLimiter:   ll,
 	}
 
 	return app, nil
 }
 
+func setupJWTKeys(cfg Config) error {
+	var ks *helpers.JWTKeySet
+	var err error
+
+	switch {
+	case len(cfg.JWTKeysFile) > 0:
+		ks, err = helpers.LoadJWTKeySet(cfg.JWTKeysFile)
+	case len(cfg.JWTSecret) > 0:
+		ks, err = helpers.NewHMACKeySet(cfg.JWTSecret)
+	default:
+		logger.Infof("no jwt signing keys configured, using a random secret: tokens will not survive restarts")
+		ks, err = helpers.NewRandomHMACKeySet()
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot set up jwt keys: %w", err)
+	}
+
+	helpers.SetJWTKeys(ks)
+
+	return nil
+}
+
+func bootstrapAdmins(cfg Config, storage *storage.Storage) {
+	for _, login := range cfg.AdminLogins {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		err := storage.GrantRoleByLogin(ctx, login, models.RoleAdmin)
+		cancel()
+
+		if err != nil {
+			logger.Infof("cannot grant admin role to %s: %v", login, err)
+		}
+	}
+}
+
+func newLoginLimiter(cfg Config, storage *storage.Storage) (*services.LoginLimiter, error) {
+	var store services.LoginAttemptStore
+
+	switch cfg.LoginAttemptsStore {
+	case LoginAttemptsMemory, "":
+		store = services.NewMemoryAttemptStore()
+	case LoginAttemptsPostgres:
+		store = storage
+	default:
+		return nil, fmt.Errorf("unknown login attempts store: %s", cfg.LoginAttemptsStore)
+	}
+
+	login := services.DefaultLoginPolicy
+	if cfg.LoginMaxFailures > 0 {
+		login.LockoutThreshold = cfg.LoginMaxFailures
+	}
+	if cfg.LoginLockout > 0 {
+		login.LockoutDuration = cfg.LoginLockout
+	}
+
+	return services.NewLoginLimiter(store, storage, login, services.DefaultIPPolicy), nil
+}
+
+func accrualOptions(cfg Config) []services.AccrualOption {
+	opts := []services.AccrualOption{
+		services.WithTimeout(cfg.AccrualTimeout),
+		services.WithMaxIdleConns(cfg.AccrualMaxIdleConns),
+	}
+
+	if len(cfg.AccrualCAFile) > 0 {
+		opts = append(opts, services.WithCACert(cfg.AccrualCAFile))
+	}
+
+	if len(cfg.AccrualCertFile) > 0 || len(cfg.AccrualKeyFile) > 0 {
+		opts = append(opts, services.WithClientCert(cfg.AccrualCertFile, cfg.AccrualKeyFile))
+	}
+
+	if name, value, ok := strings.Cut(cfg.AccrualAuthHeader, ":"); ok {
+		opts = append(opts, services.WithAuthHeader(strings.TrimSpace(name), strings.TrimSpace(value)))
+	}
+
+	return opts
+}
+
 func (app *App) Run() {
-	userHandler := handlers.NewUserHandler(app.storage, app.accrualService, app.pool)
+	go app.poller.Recover()
+	go app.poller.Run()
+
+	if app.reconciler != nil {
+		go app.reconciler.Run()
+	}
+
+	userHandler := handlers.NewUserHandler(app.storage, app.poller, app.loginLimiter)
+
+	app.router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		jwks, err := helpers.GetJWKS()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			return
+		}
+
+		c.JSON(http.StatusOK, jwks)
+	})
+
+	adminHandler := handlers.NewAdminHandler(app.storage)
+
+	adminAPI := app.router.Group("/api/admin", middleware.Auth(app.storage))
+	{
+		supportAPI := adminAPI.Group("", middleware.RequireRole(models.RoleSupport, models.RoleAdmin))
+		{
+			supportAPI.GET("/users", adminHandler.SearchUsers)
+			supportAPI.GET("/users/:id/orders", adminHandler.GetUserOrders)
+			supportAPI.GET("/users/:id/withdrawals", adminHandler.GetUserWithdrawals)
+			supportAPI.GET("/orders/:number/history", adminHandler.GetOrderHistory)
+			supportAPI.GET("/users/:id/adjustments", adminHandler.GetUserAdjustments)
+		}
+
+		adminOnly := adminAPI.Group("", middleware.RequireRole(models.RoleAdmin))
+		{
+			adminOnly.PUT("/users/:id/roles", adminHandler.SetUserRoles)
+			adminOnly.POST("/users/:id/adjustments", adminHandler.AdjustBalance)
+			adminOnly.GET("/reconciliation", adminHandler.GetReconciliation)
+			adminOnly.GET("/accrual/breaker", func(c *gin.Context) {
+				c.JSON(http.StatusOK, services.BreakerMetrics())
+			})
+		}
+	}
 
 	userAPI := app.router.Group("/api/user")
 	{
 		userAPI.POST("/register", userHandler.Register)
 		userAPI.POST("/login", userHandler.Login)
+		userAPI.POST("/token/refresh", userHandler.RefreshToken)
 
-		userAPI.Use(middleware.Auth())
+		userAPI.Use(middleware.Auth(app.storage))
 		{
 			userAPI.POST("/orders", userHandler.SubmitOrder)
 			userAPI.GET("/orders", userHandler.GetOrders)
 			userAPI.GET("/balance", userHandler.GetBalance)
 			userAPI.POST("/balance/withdraw", userHandler.WithdrawBalance)
 			userAPI.GET("/withdrawals", userHandler.GetWithdrawals)
+			userAPI.GET("/balance/adjustments", userHandler.GetAdjustments)
+			userAPI.GET("/balance/history", userHandler.GetBalanceHistory)
+			userAPI.POST("/logout", userHandler.Logout)
+			userAPI.POST("/password", userHandler.ChangePassword)
+			userAPI.GET("/account", userHandler.GetAccount)
+			userAPI.DELETE("/account", userHandler.DeleteAccount)
+		}
+	}
+
+	if app.cfg.AccrualMode == AccrualModeBuiltin {
+		rewardHandler := handlers.NewRewardHandler(app.storage)
+
+		// rules and registered orders decide how many points users get, so
+		// they are managed by admins like balance adjustments
+		rewardsAPI := app.router.Group("/api/rewards", middleware.Auth(app.storage), middleware.RequireRole(models.RoleAdmin))
+		{
+			rewardsAPI.POST("/orders", rewardHandler.RegisterOrder)
+			rewardsAPI.GET("/goods", rewardHandler.GetRules)
+			rewardsAPI.POST("/goods", rewardHandler.CreateRule)
+			rewardsAPI.DELETE("/goods/:id", rewardHandler.DeleteRule)
 		}
 	}
 
@@ -72,10 +324,15 @@ func (app *App) Run() {
 }
 
 func (app *App) Shutdown() {
+	app.poller.Stop()
+
+	if app.reconciler != nil {
+		app.reconciler.Stop()
+	}
+	app.pool.Stop()
+
 	err := app.storage.Close()
 	if err != nil {
 		logger.Infof("db close error: %v", err)
 	}
-
-	app.pool.Stop()
 }
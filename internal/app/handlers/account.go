@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// checkPassword answers the request itself unless the password of the
+// principal matches. Wrong guesses count as failed logins.
+func (uh *UserHandler) checkPassword(c *gin.Context, userID uint, password string) (*models.User, bool) {
+	user, err := uh.storage.GetUserByID(nil, userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+		return nil, false
+	}
+
+	if wait := uh.loginWait(c, user.Login); wait > 0 {
+		lockedOut(c, wait)
+		return nil, false
+	}
+
+	if ok, _ := helpers.VerifyPassword(user.Password, password); !ok {
+		uh.loginFailed(c, user.Login)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Wrong password"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (uh *UserHandler) ChangePassword(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.CurrentPassword) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if msg := helpers.ValidatePassword(req.NewPassword); len(msg) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid credentials",
+			"fields": helpers.FieldErrors{{Field: "new_password", Message: msg}},
+		})
+		return
+	}
+
+	if _, ok := uh.checkPassword(c, principal.UserID, req.CurrentPassword); !ok {
+		return
+	}
+
+	hash, err := helpers.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	err = uh.storage.ChangeUserPassword(c.Request.Context(), principal.UserID, hash, principal.SessionID)
+	if err != nil {
+		logger.Infof("ChangePassword: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, other sessions are logged out"})
+}
+
+func (uh *UserHandler) GetAccount(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	account, err := uh.storage.GetAccount(c.Request.Context(), principal.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if account == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteAccount closes the account for good, see storage.DeleteUser for what
+// is kept. The remaining balance is forfeited.
+func (uh *UserHandler) DeleteAccount(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var req deleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Password) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password confirmation is required"})
+		return
+	}
+
+	if _, ok := uh.checkPassword(c, principal.UserID, req.Password); !ok {
+		return
+	}
+
+	err := uh.storage.DeleteUser(c.Request.Context(), principal.UserID)
+	if err != nil {
+		if err == storage.ErrUserNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+		} else {
+			logger.Infof("DeleteAccount: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	clearTokenCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestUserHandler_ChangePassword(t *testing.T) {
+	hash, _ := helpers.HashPassword("Old-passw0rd")
+	user := &models.User{ID: 1, Login: "testuser", Password: hash}
+
+	tests := []struct {
+		name            string
+		requestBody     string
+		needMockGetUser bool
+		needMockChange  bool
+		mockChangeErr   error
+		expectedCode    int
+		expectedBody    string
+	}{
+		{
+			name:            "Password changed",
+			requestBody:     `{"current_password":"Old-passw0rd","new_password":"New-passw0rd"}`,
+			needMockGetUser: true,
+			needMockChange:  true,
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"message":"Password changed, other sessions are logged out"}`,
+		},
+		{
+			name:            "Wrong current password",
+			requestBody:     `{"current_password":"wrong","new_password":"New-passw0rd"}`,
+			needMockGetUser: true,
+			expectedCode:    http.StatusForbidden,
+			expectedBody:    `{"error":"Wrong password"}`,
+		},
+		{
+			name:         "Weak new password",
+			requestBody:  `{"current_password":"Old-passw0rd","new_password":"short"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid credentials","fields":[{"field":"new_password","message":"must be at least 8 characters long"}]}`,
+		},
+		{
+			name:         "Missing current password",
+			requestBody:  `{"new_password":"New-passw0rd"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid request format"}`,
+		},
+		{
+			name:            "Storage error",
+			requestBody:     `{"current_password":"Old-passw0rd","new_password":"New-passw0rd"}`,
+			needMockGetUser: true,
+			needMockChange:  true,
+			mockChangeErr:   errors.New("Something went wrong"),
+			expectedCode:    http.StatusInternalServerError,
+			expectedBody:    `{"error":"Something went wrong"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1, SessionID: "sid"})
+			})
+			router.POST("/api/user/password", handler.ChangePassword)
+
+			if tt.needMockGetUser {
+				storageMock.On("GetUserByID", mock.Anything, uint(1)).Return(user, nil)
+			}
+
+			if tt.needMockChange {
+				isHashed := mock.MatchedBy(func(hash string) bool {
+					ok, _ := helpers.VerifyPassword(hash, "New-passw0rd")
+					return ok && hash != "New-passw0rd"
+				})
+				storageMock.On("ChangeUserPassword", mock.Anything, uint(1), isHashed, "sid").Return(tt.mockChangeErr)
+			}
+
+			req, _ := http.NewRequest("POST", "/api/user/password", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_ChangePasswordLockedOut(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	storageMock := &storage.MockStorager{}
+	limiterMock := &mockLoginLimiter{}
+	handler := NewUserHandler(storageMock, nil, limiterMock)
+
+	router.Use(func(c *gin.Context) {
+		middleware.SetPrincipal(c, &middleware.Principal{UserID: 1, SessionID: "sid"})
+	})
+	router.POST("/api/user/password", handler.ChangePassword)
+
+	storageMock.On("GetUserByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+	limiterMock.On("Check", mock.Anything, "testuser", "10.0.0.1").Return(time.Millisecond*1500, nil)
+
+	req, _ := http.NewRequest("POST", "/api/user/password", strings.NewReader(`{"current_password":"Old-passw0rd","new_password":"New-passw0rd"}`))
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, `{"error":"Too many failed login attempts, try again later"}`, w.Body.String())
+
+	storageMock.AssertExpectations(t)
+	limiterMock.AssertExpectations(t)
+}
+
+func TestUserHandler_GetAccount(t *testing.T) {
+	registeredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		mockAccount    *models.Account
+		mockAccountErr error
+		expectedCode   int
+		expectedBody   string
+	}{
+		{
+			name: "Successful retrieval",
+			mockAccount: &models.Account{
+				Login:            "testuser",
+				RegisteredAt:     helpers.RFC3339Time(registeredAt),
+				OrdersCount:      3,
+				WithdrawalsCount: 1,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"login":"testuser","registered_at":"2024-01-02T03:04:05Z","orders_count":3,"withdrawals_count":1}`,
+		},
+		{
+			name:         "Deleted account",
+			mockAccount:  nil,
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: `{"error":"Account no longer exists"}`,
+		},
+		{
+			name:           "Storage error",
+			mockAccount:    nil,
+			mockAccountErr: errors.New("Something went wrong"),
+			expectedCode:   http.StatusInternalServerError,
+			expectedBody:   `{"error":"Something went wrong"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+			router.GET("/api/user/account", handler.GetAccount)
+
+			storageMock.On("GetAccount", mock.Anything, uint(1)).Return(tt.mockAccount, tt.mockAccountErr)
+
+			req, _ := http.NewRequest("GET", "/api/user/account", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_DeleteAccount(t *testing.T) {
+	hash, _ := helpers.HashPassword("Str0ng-passw0rd")
+	user := &models.User{ID: 1, Login: "testuser", Password: hash}
+
+	tests := []struct {
+		name            string
+		requestBody     string
+		needMockGetUser bool
+		needMockDelete  bool
+		mockDeleteErr   error
+		expectedCode    int
+		expectedBody    string
+	}{
+		{
+			name:            "Account deleted",
+			requestBody:     `{"password":"Str0ng-passw0rd"}`,
+			needMockGetUser: true,
+			needMockDelete:  true,
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"message":"Account deleted"}`,
+		},
+		{
+			name:            "Wrong password",
+			requestBody:     `{"password":"wrong"}`,
+			needMockGetUser: true,
+			expectedCode:    http.StatusForbidden,
+			expectedBody:    `{"error":"Wrong password"}`,
+		},
+		{
+			name:         "No confirmation",
+			requestBody:  `{}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Password confirmation is required"}`,
+		},
+		{
+			name:            "Already deleted",
+			requestBody:     `{"password":"Str0ng-passw0rd"}`,
+			needMockGetUser: true,
+			needMockDelete:  true,
+			mockDeleteErr:   storage.ErrUserNotFound,
+			expectedCode:    http.StatusUnauthorized,
+			expectedBody:    `{"error":"Account no longer exists"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+			router.DELETE("/api/user/account", handler.DeleteAccount)
+
+			if tt.needMockGetUser {
+				storageMock.On("GetUserByID", mock.Anything, uint(1)).Return(user, nil)
+			}
+
+			if tt.needMockDelete {
+				storageMock.On("DeleteUser", mock.Anything, uint(1)).Return(tt.mockDeleteErr)
+			}
+
+			req, _ := http.NewRequest("DELETE", "/api/user/account", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_GetAdjustments(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	adjs := []*models.BalanceAdjustment{
+		{ID: 3, UserID: 1, OperatorID: 9, Amount: models.MustParseMoney("10"), Reason: models.AdjustmentGoodwill, Comment: "sorry", CreatedAt: helpers.RFC3339Time(created)},
+		{ID: 4, UserID: 1, OperatorID: 9, Amount: models.MustParseMoney("-5"), Reason: models.AdjustmentCorrection, Comment: "typo", CreatedAt: helpers.RFC3339Time(created.Add(time.Hour))},
+	}
+	defaultFilter := models.AdjustmentFilter{UserID: 1, Limit: defaultPageSize + 1}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cursor, _ := helpers.EncodeCursor(models.ListPosition{Time: created, ID: 3})
+	filteredCursor, _ := helpers.EncodeCursor(models.ListPosition{Time: created, ID: 3, Filter: filterHash(from, time.Time{}, nil)})
+
+	tests := []struct {
+		name           string
+		query          string
+		needMock       bool
+		mockFilter     models.AdjustmentFilter
+		mockAdjs       *[]*models.BalanceAdjustment
+		mockAdjsErr    error
+		expectedCode   int
+		expectedCursor string
+		expectedBody   string
+	}{
+		{
+			name:         "Operator is hidden",
+			needMock:     true,
+			mockFilter:   defaultFilter,
+			mockAdjs:     &[]*models.BalanceAdjustment{adjs[0]},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":3,"amount":10,"reason":"goodwill","comment":"sorry","created_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:           "First page",
+			query:          "?limit=1",
+			needMock:       true,
+			mockFilter:     models.AdjustmentFilter{UserID: 1, Limit: 2},
+			mockAdjs:       &adjs,
+			expectedCode:   http.StatusOK,
+			expectedCursor: cursor,
+			expectedBody:   `[{"id":3,"amount":10,"reason":"goodwill","comment":"sorry","created_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:         "Next page",
+			query:        "?limit=1&cursor=" + cursor,
+			needMock:     true,
+			mockFilter:   models.AdjustmentFilter{UserID: 1, After: &models.ListPosition{Time: created, ID: 3}, Limit: 2},
+			mockAdjs:     &[]*models.BalanceAdjustment{adjs[1]},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":4,"amount":-5,"reason":"correction","comment":"typo","created_at":"2024-03-01T11:00:00Z"}]`,
+		},
+		{
+			name:         "Cursor of another filter",
+			query:        "?cursor=" + filteredCursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+		{
+			name:         "Status filter",
+			query:        "?status=NEW",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Adjustments can't be filtered by status"}`,
+		},
+		{
+			name:         "Limit too big",
+			query:        "?limit=1000",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid limit"}`,
+		},
+		{
+			name:         "No adjustments",
+			needMock:     true,
+			mockFilter:   defaultFilter,
+			mockAdjs:     &[]*models.BalanceAdjustment{},
+			expectedCode: http.StatusNoContent,
+			expectedBody: ``,
+		},
+		{
+			name:         "Storage error",
+			needMock:     true,
+			mockFilter:   defaultFilter,
+			mockAdjs:     nil,
+			mockAdjsErr:  errors.New("Something went wrong"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"error":"Something went wrong"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+			router.GET("/api/user/balance/adjustments", handler.GetAdjustments)
+
+			if tt.needMock {
+				storageMock.On("GetBalanceAdjustments", mock.Anything, tt.mockFilter).Return(tt.mockAdjs, tt.mockAdjsErr)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/user/balance/adjustments"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(nextCursorHeader))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
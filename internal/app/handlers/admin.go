@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type AdminHandler struct {
+	storage storage.Storager
+}
+
+func NewAdminHandler(storage storage.Storager) *AdminHandler {
+	return &AdminHandler{storage: storage}
+}
+
+type setRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func parseUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func isKnownRole(role string) bool {
+	for _, r := range models.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetUserRoles replaces the roles of a user. The user's sessions are revoked,
+// so the new roles take effect on their next login.
+func (ah *AdminHandler) SetUserRoles(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var req setRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Roles == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	roles := make([]string, 0, len(req.Roles))
+	seen := make(map[string]bool)
+	for _, role := range req.Roles {
+		if !isKnownRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + role})
+			return
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	err := ah.storage.SetUserRoles(c.Request.Context(), userID, roles)
+	if err != nil {
+		if err == storage.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (ah *AdminHandler) SearchUsers(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("login"))
+	if len(query) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login query parameter is required"})
+		return
+	}
+
+	limit, ok := parsePageSize(c, defaultPageSize)
+	if !ok {
+		return
+	}
+
+	users, err := ah.storage.SearchUsers(c.Request.Context(), query, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// parseTimeRange reads the from and to query parameters, either RFC 3339
+// timestamps or dates. A date in to includes the whole day.
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	var bounds [2]time.Time
+
+	for i, name := range []string{"from", "to"} {
+		raw := c.Query(name)
+		if len(raw) == 0 {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, raw)
+			if err == nil && name == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " parameter"})
+			return time.Time{}, time.Time{}, false
+		}
+
+		bounds[i] = t
+	}
+
+	return bounds[0], bounds[1], true
+}
+
+// parseStatuses reads a comma separated list of order statuses from the
+// status query parameter.
+func parseStatuses(c *gin.Context) ([]models.OrderStatus, bool) {
+	var statuses []models.OrderStatus
+
+	if raw := c.Query("status"); len(raw) > 0 {
+		for _, s := range strings.Split(raw, ",") {
+			status := models.OrderStatus(strings.ToUpper(strings.TrimSpace(s)))
+			if !status.Valid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status: " + s})
+				return nil, false
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, true
+}
+
+// GetUserOrders pages through the orders of any user the same way
+// GET /api/user/orders does once list parameters are given.
+func (ah *AdminHandler) GetUserOrders(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	statuses, ok := parseStatuses(c)
+	if !ok {
+		return
+	}
+
+	q, ok := parseListQuery(c, statuses)
+	if !ok {
+		return
+	}
+
+	orders, err := ah.storage.GetOrders(c.Request.Context(), models.OrderFilter{
+		UserID:   userID,
+		Statuses: statuses,
+		From:     q.from,
+		To:       q.to,
+		Desc:     q.desc,
+		After:    q.after,
+		Limit:    q.fetchLimit(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve orders"})
+		return
+	}
+
+	page := *orders
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.UploadedAt), last.ID)) {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (ah *AdminHandler) GetUserWithdrawals(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	q, ok := parseListQuery(c, nil)
+	if !ok {
+		return
+	}
+
+	withdrawals, err := ah.storage.GetWithdrawals(c.Request.Context(), models.WithdrawalFilter{
+		UserID: userID,
+		From:   q.from,
+		To:     q.to,
+		Desc:   q.desc,
+		After:  q.after,
+		Limit:  q.fetchLimit(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	page := *withdrawals
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.ProcessedAt), last.ID)) {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (ah *AdminHandler) GetOrderHistory(c *gin.Context) {
+	history, err := ah.storage.GetAccrualHistory(c.Request.Context(), c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if history == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+type adjustBalanceRequest struct {
+	Amount  models.Money            `json:"amount"`
+	Reason  models.AdjustmentReason `json:"reason"`
+	Comment string                  `json:"comment"`
+}
+
+// AdjustBalance credits (positive amount) or debits (negative amount) a user
+// on behalf of the operator making the request.
+func (ah *AdminHandler) AdjustBalance(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var req adjustBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errors.Is(err, models.ErrMoneyPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must have at most two decimal places"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	switch {
+	case req.Amount == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be a non-zero number"})
+		return
+	case !req.Reason.Valid():
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reason: " + string(req.Reason)})
+		return
+	case len(req.Comment) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment is required"})
+		return
+	}
+
+	adj, err := ah.storage.AdjustBalance(c.Request.Context(), &models.BalanceAdjustment{
+		UserID:     userID,
+		OperatorID: principal.UserID,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+		Comment:    req.Comment,
+	})
+	if err != nil {
+		switch err {
+		case storage.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case storage.ErrInsufficientBalance:
+			c.JSON(http.StatusConflict, gin.H{"error": "Debit exceeds the user balance"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, adj)
+}
+
+func (ah *AdminHandler) GetUserAdjustments(c *gin.Context) {
+	userID, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	q, ok := parseListQuery(c, nil)
+	if !ok {
+		return
+	}
+
+	adjustments, err := ah.storage.GetBalanceAdjustments(c.Request.Context(), models.AdjustmentFilter{
+		UserID: userID,
+		From:   q.from,
+		To:     q.to,
+		Desc:   q.desc,
+		After:  q.after,
+		Limit:  q.fetchLimit(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	page := *adjustments
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.CreatedAt), last.ID)) {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetReconciliation lists the users whose cached balance doesn't match the
+// ledger. An empty list means the books are consistent.
+func (ah *AdminHandler) GetReconciliation(c *gin.Context) {
+	drifts, err := ah.storage.ReconcileBalances(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, drifts)
+}
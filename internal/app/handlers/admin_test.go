@@ -0,0 +1,580 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestAdminHandler_SetUserRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       string
+		requestBody  string
+		needMockSet  bool
+		mockRoles    []string
+		mockSetErr   error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Roles replaced",
+			userID:       "2",
+			requestBody:  `{"roles":["support","admin","support"]}`,
+			needMockSet:  true,
+			mockRoles:    []string{"support", "admin"},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"roles":["support","admin"]}`,
+		},
+		{
+			name:         "Roles cleared",
+			userID:       "2",
+			requestBody:  `{"roles":[]}`,
+			needMockSet:  true,
+			mockRoles:    []string{},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"roles":[]}`,
+		},
+		{
+			name:         "Unknown role",
+			userID:       "2",
+			requestBody:  `{"roles":["root"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Unknown role: root"}`,
+		},
+		{
+			name:         "Missing roles",
+			userID:       "2",
+			requestBody:  `{}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid request format"}`,
+		},
+		{
+			name:         "Invalid user id",
+			userID:       "abc",
+			requestBody:  `{"roles":[]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid user id"}`,
+		},
+		{
+			name:         "Unknown user",
+			userID:       "2",
+			requestBody:  `{"roles":["admin"]}`,
+			needMockSet:  true,
+			mockRoles:    []string{"admin"},
+			mockSetErr:   storage.ErrUserNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"User not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.PUT("/api/admin/users/:id/roles", handler.SetUserRoles)
+
+			if tt.needMockSet {
+				storageMock.On("SetUserRoles", mock.Anything, uint(2), tt.mockRoles).Return(tt.mockSetErr)
+			}
+
+			req, _ := http.NewRequest("PUT", "/api/admin/users/"+tt.userID+"/roles", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_SearchUsers(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		needMock     bool
+		mockLimit    int
+		mockUsers    *[]*models.UserSummary
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Users found",
+			query:        "?login=john",
+			needMock:     true,
+			mockLimit:    defaultPageSize,
+			mockUsers:    &[]*models.UserSummary{{ID: 1, Login: "john", Balance: models.MustParseMoney("10"), Roles: []string{}}},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":1,"login":"john","current":10,"withdrawn":0,"roles":[],"registered_at":"0001-01-01T00:00:00Z","deleted":false}]`,
+		},
+		{
+			name:         "Custom limit",
+			query:        "?login=john&limit=5",
+			needMock:     true,
+			mockLimit:    5,
+			mockUsers:    &[]*models.UserSummary{},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:         "Missing login",
+			query:        "",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"login query parameter is required"}`,
+		},
+		{
+			name:         "Limit too big",
+			query:        "?login=john&limit=1000",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid limit"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.GET("/api/admin/users", handler.SearchUsers)
+
+			if tt.needMock {
+				storageMock.On("SearchUsers", mock.Anything, "john", tt.mockLimit).Return(tt.mockUsers, nil)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/admin/users"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_GetUserOrders(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		needMock     bool
+		mockFilter   models.OrderFilter
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "No filters",
+			query:        "",
+			needMock:     true,
+			mockFilter:   models.OrderFilter{UserID: 2, Limit: defaultPageSize + 1},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:     "Status and date filters",
+			query:    "?status=processed,NEW&from=2024-01-01&to=2024-01-31T12:00:00Z",
+			needMock: true,
+			mockFilter: models.OrderFilter{
+				UserID:   2,
+				Statuses: []models.OrderStatus{models.PROCESSED, models.NEW},
+				From:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+				Limit:    defaultPageSize + 1,
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:         "Date in to includes the whole day",
+			query:        "?to=2024-01-31",
+			needMock:     true,
+			mockFilter:   models.OrderFilter{UserID: 2, To: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Limit: defaultPageSize + 1},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:         "Unknown status",
+			query:        "?status=DONE",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Unknown status: DONE"}`,
+		},
+		{
+			name:         "Invalid date",
+			query:        "?from=yesterday",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid from parameter"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.GET("/api/admin/users/:id/orders", handler.GetUserOrders)
+
+			if tt.needMock {
+				storageMock.On("GetOrders", mock.Anything, tt.mockFilter).Return(&[]*models.Order{}, nil)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/admin/users/2/orders"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_GetOrderHistory(t *testing.T) {
+	outcome := "pending"
+	status := models.PROCESSING
+
+	tests := []struct {
+		name         string
+		mockHistory  *models.AccrualHistory
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name: "History found",
+			mockHistory: &models.AccrualHistory{
+				Order:    models.Order{ID: 1, UserID: 2, Number: "123456789106", Status: models.PROCESSING},
+				Job:      &models.AccrualJobState{Attempts: 1},
+				Attempts: []*models.AccrualAttempt{{ID: 5, Outcome: outcome, Status: &status}},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"order":{"id":1,"user_id":2,"number":"123456789106","status":"PROCESSING","uploaded_at":"0001-01-01T00:00:00Z"},` +
+				`"job":{"attempts":1,"next_run_at":"0001-01-01T00:00:00Z"},` +
+				`"attempts":[{"id":5,"outcome":"pending","status":"PROCESSING","created_at":"0001-01-01T00:00:00Z"}]}`,
+		},
+		{
+			name:         "Unknown order",
+			mockHistory:  nil,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"Order not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.GET("/api/admin/orders/:number/history", handler.GetOrderHistory)
+
+			storageMock.On("GetAccrualHistory", mock.Anything, "123456789106").Return(tt.mockHistory, nil)
+
+			req, _ := http.NewRequest("GET", "/api/admin/orders/123456789106/history", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_AdjustBalance(t *testing.T) {
+	tests := []struct {
+		name         string
+		requestBody  string
+		needMock     bool
+		mockAdj      *models.BalanceAdjustment
+		mockResult   *models.BalanceAdjustment
+		mockErr      error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Credit",
+			requestBody:  `{"amount":25.5,"reason":"lost_accrual","comment":" order 123 was never credited "}`,
+			needMock:     true,
+			mockAdj:      &models.BalanceAdjustment{UserID: 2, OperatorID: 1, Amount: models.MustParseMoney("25.5"), Reason: models.AdjustmentLostAccrual, Comment: "order 123 was never credited"},
+			mockResult:   &models.BalanceAdjustment{ID: 3, UserID: 2, OperatorID: 1, Amount: models.MustParseMoney("25.5"), Reason: models.AdjustmentLostAccrual, Comment: "order 123 was never credited"},
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id":3,"user_id":2,"operator_id":1,"amount":25.5,"reason":"lost_accrual","comment":"order 123 was never credited","created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:         "Debit above balance",
+			requestBody:  `{"amount":-100,"reason":"fraud_reversal","comment":"duplicate order"}`,
+			needMock:     true,
+			mockAdj:      &models.BalanceAdjustment{UserID: 2, OperatorID: 1, Amount: models.MustParseMoney("-100"), Reason: models.AdjustmentFraudReversal, Comment: "duplicate order"},
+			mockErr:      storage.ErrInsufficientBalance,
+			expectedCode: http.StatusConflict,
+			expectedBody: `{"error":"Debit exceeds the user balance"}`,
+		},
+		{
+			name:         "Unknown user",
+			requestBody:  `{"amount":1,"reason":"goodwill","comment":"sorry"}`,
+			needMock:     true,
+			mockAdj:      &models.BalanceAdjustment{UserID: 2, OperatorID: 1, Amount: models.MustParseMoney("1"), Reason: models.AdjustmentGoodwill, Comment: "sorry"},
+			mockErr:      storage.ErrUserNotFound,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"User not found"}`,
+		},
+		{
+			name:         "Zero amount",
+			requestBody:  `{"amount":0,"reason":"goodwill","comment":"sorry"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Amount must be a non-zero number"}`,
+		},
+		{
+			name:         "Fractional cents",
+			requestBody:  `{"amount":1.005,"reason":"goodwill","comment":"sorry"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Amount must have at most two decimal places"}`,
+		},
+		{
+			name:         "Unknown reason",
+			requestBody:  `{"amount":1,"reason":"because","comment":"sorry"}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Unknown reason: because"}`,
+		},
+		{
+			name:         "Missing comment",
+			requestBody:  `{"amount":1,"reason":"goodwill","comment":"  "}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Comment is required"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1, Roles: []string{models.RoleAdmin}})
+			})
+			router.POST("/api/admin/users/:id/adjustments", handler.AdjustBalance)
+
+			if tt.needMock {
+				storageMock.On("AdjustBalance", mock.Anything, tt.mockAdj).Return(tt.mockResult, tt.mockErr)
+			}
+
+			req, _ := http.NewRequest("POST", "/api/admin/users/2/adjustments", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_GetReconciliation(t *testing.T) {
+	tests := []struct {
+		name         string
+		mockDrifts   *[](*models.BalanceDrift)
+		mockErr      error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name: "Drift found",
+			mockDrifts: &[](*models.BalanceDrift){
+				{UserID: 2, Login: "alice", Balance: models.MustParseMoney("100"), LedgerBalance: models.MustParseMoney("90"), Withdrawn: models.MustParseMoney("5"), LedgerWithdrawn: models.MustParseMoney("5")},
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"user_id":2,"login":"alice","balance":100,"ledger_balance":90,"withdrawn":5,"ledger_withdrawn":5}]`,
+		},
+		{
+			name:         "No drift",
+			mockDrifts:   &[](*models.BalanceDrift){},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:         "Storage error",
+			mockDrifts:   nil,
+			mockErr:      errors.New("db is down"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: `{"error":"Something went wrong"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.GET("/api/admin/reconciliation", handler.GetReconciliation)
+
+			storageMock.On("ReconcileBalances", mock.Anything).Return(tt.mockDrifts, tt.mockErr)
+
+			req, _ := http.NewRequest("GET", "/api/admin/reconciliation", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAdminHandler_UserListingsArePaged(t *testing.T) {
+	uploaded := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	orders := []*models.Order{
+		{ID: 9, UserID: 2, Number: "9278923470", Status: models.NEW, UploadedAt: helpers.RFC3339Time(uploaded.Add(time.Hour))},
+		{ID: 5, UserID: 2, Number: "12345678903", Status: models.NEW, UploadedAt: helpers.RFC3339Time(uploaded)},
+	}
+	withdrawals := []*models.Withdrawal{
+		{ID: 1, OrderNumber: "2377225624", Sum: models.MustParseMoney("500"), ProcessedAt: helpers.RFC3339Time(uploaded)},
+		{ID: 3, OrderNumber: "2377225632", Sum: models.MustParseMoney("0.5"), ProcessedAt: helpers.RFC3339Time(uploaded.Add(time.Minute))},
+	}
+
+	adjustments := []*models.BalanceAdjustment{
+		{ID: 7, UserID: 2, OperatorID: 9, Amount: models.MustParseMoney("10"), Reason: models.AdjustmentGoodwill, Comment: "sorry", CreatedAt: helpers.RFC3339Time(uploaded)},
+		{ID: 8, UserID: 2, OperatorID: 9, Amount: models.MustParseMoney("-5"), Reason: models.AdjustmentCorrection, Comment: "typo", CreatedAt: helpers.RFC3339Time(uploaded.Add(time.Hour))},
+	}
+
+	ordersCursor, _ := helpers.EncodeCursor(models.ListPosition{Time: uploaded.Add(time.Hour), ID: 9, Desc: true})
+	withdrawalsCursor, _ := helpers.EncodeCursor(models.ListPosition{Time: uploaded, ID: 1})
+	adjustmentsCursor, _ := helpers.EncodeCursor(models.ListPosition{Time: uploaded, ID: 7})
+
+	tests := []struct {
+		name           string
+		path           string
+		mock           func(m *storage.MockStorager)
+		expectedCode   int
+		expectedCursor string
+		expectedBody   string
+	}{
+		{
+			name: "Orders, first page",
+			path: "/api/admin/users/2/orders?sort=desc&limit=1",
+			mock: func(m *storage.MockStorager) {
+				m.On("GetOrders", mock.Anything, models.OrderFilter{UserID: 2, Desc: true, Limit: 2}).Return(&orders, nil)
+			},
+			expectedCode:   http.StatusOK,
+			expectedCursor: ordersCursor,
+			expectedBody:   `[{"id":9,"user_id":2,"number":"9278923470","status":"NEW","uploaded_at":"2024-03-01T11:00:00Z"}]`,
+		},
+		{
+			name: "Orders, next page",
+			path: "/api/admin/users/2/orders?sort=desc&limit=1&cursor=" + ordersCursor,
+			mock: func(m *storage.MockStorager) {
+				after := models.ListPosition{Time: uploaded.Add(time.Hour), ID: 9, Desc: true}
+				page := orders[1:]
+				m.On("GetOrders", mock.Anything, models.OrderFilter{UserID: 2, Desc: true, After: &after, Limit: 2}).Return(&page, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":5,"user_id":2,"number":"12345678903","status":"NEW","uploaded_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name: "Withdrawals, first page",
+			path: "/api/admin/users/2/withdrawals?limit=1",
+			mock: func(m *storage.MockStorager) {
+				m.On("GetWithdrawals", mock.Anything, models.WithdrawalFilter{UserID: 2, Limit: 2}).Return(&withdrawals, nil)
+			},
+			expectedCode:   http.StatusOK,
+			expectedCursor: withdrawalsCursor,
+			expectedBody:   `[{"order":"2377225624","sum":500,"processed_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name: "Withdrawals use the default page size",
+			path: "/api/admin/users/2/withdrawals",
+			mock: func(m *storage.MockStorager) {
+				empty := []*models.Withdrawal{}
+				m.On("GetWithdrawals", mock.Anything, models.WithdrawalFilter{UserID: 2, Limit: defaultPageSize + 1}).Return(&empty, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name: "Adjustments, first page",
+			path: "/api/admin/users/2/adjustments?limit=1",
+			mock: func(m *storage.MockStorager) {
+				m.On("GetBalanceAdjustments", mock.Anything, models.AdjustmentFilter{UserID: 2, Limit: 2}).Return(&adjustments, nil)
+			},
+			expectedCode:   http.StatusOK,
+			expectedCursor: adjustmentsCursor,
+			expectedBody:   `[{"id":7,"user_id":2,"operator_id":9,"amount":10,"reason":"goodwill","comment":"sorry","created_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name: "Adjustments use the default page size",
+			path: "/api/admin/users/2/adjustments",
+			mock: func(m *storage.MockStorager) {
+				empty := []*models.BalanceAdjustment{}
+				m.On("GetBalanceAdjustments", mock.Anything, models.AdjustmentFilter{UserID: 2, Limit: defaultPageSize + 1}).Return(&empty, nil)
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `[]`,
+		},
+		{
+			name:         "Adjustments cursor used with a filter",
+			path:         "/api/admin/users/2/adjustments?from=2024-01-01&cursor=" + adjustmentsCursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+		{
+			name:         "Limit too big",
+			path:         "/api/admin/users/2/orders?limit=1000",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid limit"}`,
+		},
+		{
+			name:         "Cursor of another listing order",
+			path:         "/api/admin/users/2/orders?cursor=" + ordersCursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewAdminHandler(storageMock)
+			router.GET("/api/admin/users/:id/orders", handler.GetUserOrders)
+			router.GET("/api/admin/users/:id/withdrawals", handler.GetUserWithdrawals)
+			router.GET("/api/admin/users/:id/adjustments", handler.GetUserAdjustments)
+
+			if tt.mock != nil {
+				tt.mock(storageMock)
+			}
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(nextCursorHeader))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type historyCursor struct {
+	ID uint `json:"id"`
+}
+
+// GetBalanceHistory lists every change of the user's balance, oldest first,
+// with the balance after each change. Pages are requested with limit and the
+// cursor from the X-Next-Cursor header of the previous page.
+func (uh *UserHandler) GetBalanceHistory(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	filter := models.BalanceHistoryFilter{UserID: principal.UserID}
+
+	limit, ok := parsePageSize(c, defaultPageSize)
+	if !ok {
+		return
+	}
+
+	var cursor historyCursor
+	if !parseCursor(c, &cursor) {
+		return
+	}
+	filter.AfterID = cursor.ID
+
+	filter.From, filter.To, ok = parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	// one extra event tells whether there is a next page
+	filter.Limit = limit + 1
+
+	events, err := uh.storage.GetBalanceHistory(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	page := *events
+	if len(page) > limit {
+		page = page[:limit]
+		if !setNextCursor(c, historyCursor{ID: page[len(page)-1].ID}) {
+			return
+		}
+	}
+
+	if len(page) == 0 {
+		c.JSON(http.StatusNoContent, []models.BalanceEvent{})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestUserHandler_GetBalanceHistory(t *testing.T) {
+	order := "123456789106"
+	events := []*models.BalanceEvent{
+		{ID: 4, Kind: models.LedgerAccrual, Ref: &order, Amount: models.MustParseMoney("500"), Balance: models.MustParseMoney("500")},
+		{ID: 7, Kind: models.LedgerWithdrawal, Ref: &order, Amount: models.MustParseMoney("-20.5"), Balance: models.MustParseMoney("479.5")},
+		{ID: 9, Kind: models.LedgerAdjustment, Amount: models.MustParseMoney("1"), Balance: models.MustParseMoney("480.5")},
+	}
+	cursor, _ := helpers.EncodeCursor(historyCursor{ID: 7})
+
+	tests := []struct {
+		name           string
+		query          string
+		mockFilter     *models.BalanceHistoryFilter
+		mockEvents     []*models.BalanceEvent
+		expectedCode   int
+		expectedCursor string
+		expectedBody   string
+	}{
+		{
+			name:         "Whole history",
+			query:        "",
+			mockFilter:   &models.BalanceHistoryFilter{UserID: 1, Limit: defaultPageSize + 1},
+			mockEvents:   events[:2],
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":4,"type":"accrual","ref":"123456789106","amount":500,"balance":500,"created_at":"0001-01-01T00:00:00Z"},` +
+				`{"id":7,"type":"withdrawal","ref":"123456789106","amount":-20.5,"balance":479.5,"created_at":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:           "First page",
+			query:          "?limit=2",
+			mockFilter:     &models.BalanceHistoryFilter{UserID: 1, Limit: 3},
+			mockEvents:     events,
+			expectedCode:   http.StatusOK,
+			expectedCursor: cursor,
+			expectedBody: `[{"id":4,"type":"accrual","ref":"123456789106","amount":500,"balance":500,"created_at":"0001-01-01T00:00:00Z"},` +
+				`{"id":7,"type":"withdrawal","ref":"123456789106","amount":-20.5,"balance":479.5,"created_at":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:         "Next page in a date range",
+			query:        "?limit=2&cursor=" + cursor + "&from=2024-01-01&to=2024-01-31",
+			mockFilter:   &models.BalanceHistoryFilter{UserID: 1, AfterID: 7, From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Limit: 3},
+			mockEvents:   events[2:],
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":9,"type":"adjustment","amount":1,"balance":480.5,"created_at":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:         "No events",
+			query:        "",
+			mockFilter:   &models.BalanceHistoryFilter{UserID: 1, Limit: defaultPageSize + 1},
+			mockEvents:   []*models.BalanceEvent{},
+			expectedCode: http.StatusNoContent,
+			expectedBody: ``,
+		},
+		{
+			name:         "Invalid cursor",
+			query:        "?cursor=garbage",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid cursor"}`,
+		},
+		{
+			name:         "Invalid limit",
+			query:        "?limit=1000",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid limit"}`,
+		},
+		{
+			name:         "Invalid date",
+			query:        "?from=yesterday",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid from parameter"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+
+			router.GET("/api/user/balance/history", handler.GetBalanceHistory)
+
+			if tt.mockFilter != nil {
+				storageMock.On("GetBalanceHistory", mock.Anything, *tt.mockFilter).Return(&tt.mockEvents, nil)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/user/balance/history"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(nextCursorHeader))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// parsePageSize reads the limit query parameter, falling back to def when it
+// is absent.
+func parsePageSize(c *gin.Context, def int) (int, bool) {
+	raw := c.Query("limit")
+	if len(raw) == 0 {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 || n > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return 0, false
+	}
+
+	return n, true
+}
+
+// parseCursor decodes the cursor query parameter into position. A missing
+// cursor leaves position untouched.
+func parseCursor(c *gin.Context, position interface{}) bool {
+	raw := c.Query("cursor")
+	if len(raw) == 0 {
+		return true
+	}
+
+	if err := helpers.DecodeCursor(raw, position); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return false
+	}
+
+	return true
+}
+
+// setNextCursor advertises the page after position in the X-Next-Cursor
+// header, so list bodies keep their shape.
+func setNextCursor(c *gin.Context, position interface{}) bool {
+	cursor, err := helpers.EncodeCursor(position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return false
+	}
+
+	c.Header(nextCursorHeader, cursor)
+
+	return true
+}
+
+// listParams are the query parameters that switch a user listing from the
+// spec behaviour, everything in ascending order, to a filtered or paged one.
+var listParams = []string{"limit", "cursor", "status", "from", "to", "sort"}
+
+func hasListParams(c *gin.Context) bool {
+	for _, name := range listParams {
+		if _, ok := c.GetQuery(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listQuery is a parsed set of listParams, except status which is parsed by
+// the order listing and passed in.
+type listQuery struct {
+	from   time.Time
+	to     time.Time
+	desc   bool
+	filter string
+	after  *models.ListPosition
+	limit  int
+}
+
+// parseListQuery reads the listParams of a paged listing: user listings once
+// the client sent any of them, admin listings always. Pages hold
+// defaultPageSize items unless limit says otherwise.
+func parseListQuery(c *gin.Context, statuses []models.OrderStatus) (*listQuery, bool) {
+	var q listQuery
+	var ok bool
+
+	q.from, q.to, ok = parseTimeRange(c)
+	if !ok {
+		return nil, false
+	}
+
+	switch strings.ToLower(c.DefaultQuery("sort", "asc")) {
+	case "asc":
+	case "desc":
+		q.desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, use asc or desc"})
+		return nil, false
+	}
+
+	q.filter = filterHash(q.from, q.to, statuses)
+
+	var after models.ListPosition
+	if !parseCursor(c, &after) {
+		return nil, false
+	}
+	if after.ID > 0 {
+		if after.Desc != q.desc || after.Filter != q.filter {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cursor doesn't match the query"})
+			return nil, false
+		}
+		q.after = &after
+	}
+
+	q.limit, ok = parsePageSize(c, defaultPageSize)
+	if !ok {
+		return nil, false
+	}
+
+	return &q, true
+}
+
+// filterHash identifies the filtered set a cursor was issued for. It is
+// empty for unfiltered listings, which keeps their cursors short.
+func filterHash(from, to time.Time, statuses []models.OrderStatus) string {
+	if from.IsZero() && to.IsZero() && len(statuses) == 0 {
+		return ""
+	}
+
+	set := make([]string, len(statuses))
+	for i, status := range statuses {
+		set[i] = string(status)
+	}
+	sort.Strings(set)
+
+	var b strings.Builder
+	for _, t := range []time.Time{from, to} {
+		if !t.IsZero() {
+			b.WriteString(t.UTC().Format(time.RFC3339Nano))
+		}
+		b.WriteByte('|')
+	}
+	b.WriteString(strings.Join(set, ","))
+
+	sum := sha256.Sum256([]byte(b.String()))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// position is the cursor of a page that ended at the item with t and id.
+func (q *listQuery) position(t time.Time, id uint) models.ListPosition {
+	return models.ListPosition{Time: t, ID: id, Desc: q.desc, Filter: q.filter}
+}
+
+// fetchLimit asks storage for one item more than a page, which tells whether
+// there is a next page.
+func (q *listQuery) fetchLimit() int {
+	return q.limit + 1
+}
+
+// hasMore reports whether a result of n items fetched with fetchLimit goes
+// on past the page.
+func (q *listQuery) hasMore(n int) bool {
+	return n > q.limit
+}
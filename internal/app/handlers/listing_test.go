@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestUserHandler_GetOrdersListing(t *testing.T) {
+	uploaded := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	orders := []*models.Order{
+		{ID: 9, UserID: 1, Number: "9278923470", Status: models.PROCESSED, UploadedAt: helpers.RFC3339Time(uploaded.Add(time.Hour))},
+		{ID: 5, UserID: 1, Number: "12345678903", Status: models.PROCESSED, UploadedAt: helpers.RFC3339Time(uploaded)},
+		{ID: 2, UserID: 1, Number: "346436439", Status: models.PROCESSED, UploadedAt: helpers.RFC3339Time(uploaded)},
+	}
+
+	position := models.ListPosition{Time: uploaded, ID: 5, Desc: true, Filter: filterHash(time.Time{}, time.Time{}, []models.OrderStatus{models.PROCESSED})}
+	cursor, _ := helpers.EncodeCursor(position)
+	ascCursor, _ := helpers.EncodeCursor(models.ListPosition{Time: uploaded, ID: 5, Filter: position.Filter})
+
+	tests := []struct {
+		name           string
+		query          string
+		mockFilter     *models.OrderFilter
+		mockOrders     []*models.Order
+		expectedCode   int
+		expectedCursor string
+		expectedBody   string
+	}{
+		{
+			name:  "Newest processed orders, first page",
+			query: "?status=processed&sort=desc&limit=2",
+			mockFilter: &models.OrderFilter{
+				UserID:   1,
+				Statuses: []models.OrderStatus{models.PROCESSED},
+				Desc:     true,
+				Limit:    3,
+			},
+			mockOrders:     orders,
+			expectedCode:   http.StatusOK,
+			expectedCursor: cursor,
+			expectedBody: `[{"id":9,"user_id":1,"number":"9278923470","status":"PROCESSED","uploaded_at":"2024-03-01T11:00:00Z"},` +
+				`{"id":5,"user_id":1,"number":"12345678903","status":"PROCESSED","uploaded_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:  "Next page uses the default page size",
+			query: "?status=processed&sort=desc&cursor=" + cursor,
+			mockFilter: &models.OrderFilter{
+				UserID:   1,
+				Statuses: []models.OrderStatus{models.PROCESSED},
+				Desc:     true,
+				After:    &position,
+				Limit:    defaultPageSize + 1,
+			},
+			mockOrders:   orders[2:],
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":2,"user_id":1,"number":"346436439","status":"PROCESSED","uploaded_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:         "Filter only, nothing found",
+			query:        "?from=2024-03-02",
+			mockFilter:   &models.OrderFilter{UserID: 1, From: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), Limit: defaultPageSize + 1},
+			mockOrders:   []*models.Order{},
+			expectedCode: http.StatusNoContent,
+			expectedBody: ``,
+		},
+		{
+			name:         "Sort only is paged too",
+			query:        "?sort=desc",
+			mockFilter:   &models.OrderFilter{UserID: 1, Desc: true, Limit: defaultPageSize + 1},
+			mockOrders:   orders[2:],
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"id":2,"user_id":1,"number":"346436439","status":"PROCESSED","uploaded_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:         "Cursor of another sort order",
+			query:        "?status=processed&cursor=" + cursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+		{
+			name:         "Cursor of another status filter",
+			query:        "?status=new&sort=desc&cursor=" + cursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+		{
+			name:         "Cursor of another date range",
+			query:        "?status=processed&from=2024-03-01&cursor=" + ascCursor,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Cursor doesn't match the query"}`,
+		},
+		{
+			name:         "Invalid sort",
+			query:        "?sort=newest",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid sort, use asc or desc"}`,
+		},
+		{
+			name:         "Invalid status",
+			query:        "?status=LOST",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Unknown status: LOST"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+
+			router.GET("/api/user/orders", handler.GetOrders)
+
+			if tt.mockFilter != nil {
+				storageMock.On("GetOrders", mock.Anything, *tt.mockFilter).Return(&tt.mockOrders, nil)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/user/orders"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(nextCursorHeader))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_GetWithdrawalsListing(t *testing.T) {
+	processed := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	withdrawals := []*models.Withdrawal{
+		{ID: 1, OrderNumber: "2377225624", Sum: models.MustParseMoney("500"), ProcessedAt: helpers.RFC3339Time(processed)},
+		{ID: 3, OrderNumber: "2377225632", Sum: models.MustParseMoney("0.5"), ProcessedAt: helpers.RFC3339Time(processed.Add(time.Minute))},
+	}
+
+	cursor, _ := helpers.EncodeCursor(models.ListPosition{Time: processed, ID: 1})
+
+	tests := []struct {
+		name           string
+		query          string
+		mockFilter     *models.WithdrawalFilter
+		expectedCode   int
+		expectedCursor string
+		expectedBody   string
+	}{
+		{
+			name:           "First page",
+			query:          "?limit=1",
+			mockFilter:     &models.WithdrawalFilter{UserID: 1, Limit: 2},
+			expectedCode:   http.StatusOK,
+			expectedCursor: cursor,
+			expectedBody:   `[{"order":"2377225624","sum":500,"processed_at":"2024-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:         "Whole listing fits the page",
+			query:        "?limit=5",
+			mockFilter:   &models.WithdrawalFilter{UserID: 1, Limit: 6},
+			expectedCode: http.StatusOK,
+			expectedBody: `[{"order":"2377225624","sum":500,"processed_at":"2024-03-01T10:00:00Z"},` +
+				`{"order":"2377225632","sum":0.5,"processed_at":"2024-03-01T10:01:00Z"}]`,
+		},
+		{
+			name:         "Status is not supported",
+			query:        "?status=NEW",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Withdrawals can't be filtered by status"}`,
+		},
+		{
+			name:         "Invalid limit",
+			query:        "?limit=0",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid limit"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+
+			router.GET("/api/user/withdrawals", handler.GetWithdrawals)
+
+			if tt.mockFilter != nil {
+				storageMock.On("GetWithdrawals", mock.Anything, *tt.mockFilter).Return(&withdrawals, nil)
+			}
+
+			req, _ := http.NewRequest("GET", "/api/user/withdrawals"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCursor, w.Header().Get(nextCursorHeader))
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFilterHash(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	both := []models.OrderStatus{models.NEW, models.PROCESSED}
+
+	assert.Empty(t, filterHash(time.Time{}, time.Time{}, nil))
+	assert.NotEmpty(t, filterHash(day, time.Time{}, nil))
+
+	assert.Equal(t, filterHash(day, time.Time{}, both), filterHash(day, time.Time{}, []models.OrderStatus{models.PROCESSED, models.NEW}))
+	assert.Equal(t, filterHash(day, time.Time{}, nil), filterHash(day.In(time.FixedZone("MSK", 3*3600)), time.Time{}, nil))
+
+	assert.NotEqual(t, filterHash(day, time.Time{}, nil), filterHash(time.Time{}, day, nil))
+	assert.NotEqual(t, filterHash(time.Time{}, time.Time{}, both), filterHash(time.Time{}, time.Time{}, both[:1]))
+}
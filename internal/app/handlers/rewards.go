@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type RewardHandler struct {
+	storage storage.Storager
+}
+
+func NewRewardHandler(storage storage.Storager) *RewardHandler {
+	return &RewardHandler{storage: storage}
+}
+
+func (rh *RewardHandler) RegisterOrder(c *gin.Context) {
+	var order models.RewardOrder
+	if err := c.ShouldBindJSON(&order); err != nil {
+		if errors.Is(err, models.ErrMoneyPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price must have at most two decimal places"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if len(order.Number) == 0 || !helpers.IsOrderNumberValid(order.Number) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Wrong order format"})
+		return
+	}
+
+	if len(order.Goods) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no goods"})
+		return
+	}
+
+	for _, good := range order.Goods {
+		if len(strings.TrimSpace(good.Description)) == 0 || good.Price < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goods"})
+			return
+		}
+	}
+
+	err := rh.storage.CreateRewardOrder(c.Request.Context(), &order)
+	if err != nil {
+		if err == storage.ErrOrderAlreadyExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is already registered"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Order registered"})
+}
+
+func (rh *RewardHandler) CreateRule(c *gin.Context) {
+	var rule models.RewardRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		if errors.Is(err, models.ErrMoneyPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reward must have at most two decimal places"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	rule.Match = strings.TrimSpace(rule.Match)
+	if len(rule.Match) == 0 || rule.Reward <= 0 ||
+		(rule.RewardType != models.RewardPercent && rule.RewardType != models.RewardPoints) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reward rule"})
+		return
+	}
+
+	created, err := rh.storage.CreateRewardRule(c.Request.Context(), &rule)
+	if err != nil {
+		if err == storage.ErrRewardRuleExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Reward rule for this match already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+func (rh *RewardHandler) GetRules(c *gin.Context) {
+	rules, err := rh.storage.GetRewardRules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (rh *RewardHandler) DeleteRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule id"})
+		return
+	}
+
+	err = rh.storage.DeleteRewardRule(c.Request.Context(), uint(ruleID))
+	if err != nil {
+		if err == storage.ErrRewardRuleNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reward rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reward rule deleted"})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestRewardHandler_RegisterOrder(t *testing.T) {
+	tests := []struct {
+		name                string
+		requestBody         interface{}
+		needMockCreateOrder bool
+		mockCreateOrderErr  error
+		expectedCode        int
+		expectedBody        string
+	}{
+		{
+			name:                "Valid order",
+			requestBody:         gin.H{"order": "123456789106", "goods": []gin.H{{"description": "Чайник Bork", "price": 7000}}},
+			needMockCreateOrder: true,
+			expectedCode:        http.StatusAccepted,
+			expectedBody:        `{"message":"Order registered"}`,
+		},
+		{
+			name:         "Invalid order number",
+			requestBody:  gin.H{"order": "12345", "goods": []gin.H{{"description": "Чайник Bork", "price": 7000}}},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"error":"Wrong order format"}`,
+		},
+		{
+			name:         "Price with more than two decimal places",
+			requestBody:  gin.H{"order": "123456789106", "goods": []gin.H{{"description": "Чайник Bork", "price": 70.005}}},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Price must have at most two decimal places"}`,
+		},
+		{
+			name:         "Negative price",
+			requestBody:  gin.H{"order": "123456789106", "goods": []gin.H{{"description": "Чайник Bork", "price": -1}}},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid goods"}`,
+		},
+		{
+			name:         "No goods",
+			requestBody:  gin.H{"order": "123456789106", "goods": []gin.H{}},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Order has no goods"}`,
+		},
+		{
+			name:                "Already registered",
+			requestBody:         gin.H{"order": "123456789106", "goods": []gin.H{{"description": "Чайник Bork", "price": 7000}}},
+			needMockCreateOrder: true,
+			mockCreateOrderErr:  storage.ErrOrderAlreadyExists,
+			expectedCode:        http.StatusConflict,
+			expectedBody:        `{"error":"Order is already registered"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewRewardHandler(storageMock)
+			router.POST("/api/rewards/orders", handler.RegisterOrder)
+
+			if tt.needMockCreateOrder {
+				storageMock.On("CreateRewardOrder", mock.Anything, mock.Anything).Return(tt.mockCreateOrderErr)
+			}
+
+			jsonStr, _ := json.Marshal(tt.requestBody)
+			req, _ := http.NewRequest("POST", "/api/rewards/orders", bytes.NewBuffer(jsonStr))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRewardHandler_CreateRule(t *testing.T) {
+	tests := []struct {
+		name               string
+		requestBody        interface{}
+		needMockCreateRule bool
+		mockCreateRule     *models.RewardRule
+		mockCreateRuleErr  error
+		expectedCode       int
+		expectedBody       string
+	}{
+		{
+			name:               "Valid rule",
+			requestBody:        gin.H{"match": "Bork", "reward": 10, "reward_type": "%"},
+			needMockCreateRule: true,
+			mockCreateRule:     &models.RewardRule{ID: 1, Match: "Bork", Reward: models.MustParseMoney("10"), RewardType: models.RewardPercent},
+			expectedCode:       http.StatusOK,
+			expectedBody:       `{"id":1,"match":"Bork","reward":10,"reward_type":"%"}`,
+		},
+		{
+			name:               "Fractional percent",
+			requestBody:        gin.H{"match": "Bork", "reward": 2.5, "reward_type": "%"},
+			needMockCreateRule: true,
+			mockCreateRule:     &models.RewardRule{ID: 1, Match: "Bork", Reward: models.MustParseMoney("2.5"), RewardType: models.RewardPercent},
+			expectedCode:       http.StatusOK,
+			expectedBody:       `{"id":1,"match":"Bork","reward":2.5,"reward_type":"%"}`,
+		},
+		{
+			name:         "Reward with more than two decimal places",
+			requestBody:  gin.H{"match": "Bork", "reward": 2.125, "reward_type": "%"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Reward must have at most two decimal places"}`,
+		},
+		{
+			name:         "Unknown reward type",
+			requestBody:  gin.H{"match": "Bork", "reward": 10, "reward_type": "usd"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"Invalid reward rule"}`,
+		},
+		{
+			name:               "Duplicate match",
+			requestBody:        gin.H{"match": "Bork", "reward": 10, "reward_type": "pt"},
+			needMockCreateRule: true,
+			mockCreateRuleErr:  storage.ErrRewardRuleExists,
+			expectedCode:       http.StatusConflict,
+			expectedBody:       `{"error":"Reward rule for this match already exists"}`,
+		},
+		{
+			name:               "Storage error",
+			requestBody:        gin.H{"match": "Bork", "reward": 10, "reward_type": "pt"},
+			needMockCreateRule: true,
+			mockCreateRuleErr:  errors.New("Something went wrong"),
+			expectedCode:       http.StatusInternalServerError,
+			expectedBody:       `{"error":"Something went wrong"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewRewardHandler(storageMock)
+			router.POST("/api/rewards/goods", handler.CreateRule)
+
+			if tt.needMockCreateRule {
+				storageMock.On("CreateRewardRule", mock.Anything, mock.Anything).Return(tt.mockCreateRule, tt.mockCreateRuleErr)
+			}
+
+			jsonStr, _ := json.Marshal(tt.requestBody)
+			req, _ := http.NewRequest("POST", "/api/rewards/goods", bytes.NewBuffer(jsonStr))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+const (
+	accessTokenCookie  = "jwt"
+	refreshTokenCookie = "refresh_token"
+	refreshTokenPath   = "/api/user"
+)
+
+type tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession opens a new refresh token family for the user and hands both
+// tokens to the client.
+func (uh *UserHandler) startSession(c *gin.Context, user *models.User) (*tokens, error) {
+	sessionID, err := helpers.NewSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := helpers.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = uh.storage.CreateRefreshToken(c.Request.Context(), user.ID, sessionID, hash, time.Now().Add(helpers.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := helpers.NewAccessToken(user.ID, user.Login, user.Roles, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return setTokens(c, accessToken, refreshToken), nil
+}
+
+// setTokens sets the tokens as cookies for browsers and puts the access token
+// into the Authorization header for clients that can't keep cookies.
+func setTokens(c *gin.Context, accessToken, refreshToken string) *tokens {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(accessTokenCookie, accessToken, int(helpers.AccessTokenTTL.Seconds()), "/", "", false, true)
+	c.SetCookie(refreshTokenCookie, refreshToken, int(helpers.RefreshTokenTTL.Seconds()), refreshTokenPath, "", false, true)
+	c.Header("Authorization", "Bearer "+accessToken)
+
+	return &tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(helpers.AccessTokenTTL.Seconds()),
+	}
+}
+
+// respondWithTokens adds the tokens to the response body when the client asks
+// for them with ?return_token=true.
+func respondWithTokens(c *gin.Context, message string, t *tokens) {
+	if c.Query("return_token") != "true" {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       message,
+		"access_token":  t.AccessToken,
+		"refresh_token": t.RefreshToken,
+		"token_type":    t.TokenType,
+		"expires_in":    t.ExpiresIn,
+	})
+}
+
+func clearTokenCookies(c *gin.Context) {
+	c.SetCookie(accessTokenCookie, "", -1, "/", "", false, true)
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenPath, "", false, true)
+}
+
+func (uh *UserHandler) RefreshToken(c *gin.Context) {
+	oldToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil || len(oldToken) == 0 {
+		var req refreshRequest
+		if c.ShouldBindJSON(&req) == nil {
+			oldToken = req.RefreshToken
+		}
+	}
+	if len(oldToken) == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is missing"})
+		return
+	}
+
+	newToken, newHash, err := helpers.NewRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	rt, err := uh.storage.RotateRefreshToken(c.Request.Context(), helpers.HashRefreshToken(oldToken), newHash, time.Now().Add(helpers.RefreshTokenTTL))
+	if err != nil {
+		switch err {
+		case storage.ErrRefreshTokenInvalid, storage.ErrRefreshTokenReused:
+			clearTokenCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
+		return
+	}
+
+	user, err := uh.storage.GetUserByID(nil, rt.UserID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if user == nil {
+		clearTokenCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := helpers.NewAccessToken(user.ID, user.Login, user.Roles, rt.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	respondWithTokens(c, "Token refreshed", setTokens(c, accessToken, newToken))
+}
+
+func (uh *UserHandler) Logout(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	err := uh.storage.RevokeSession(c.Request.Context(), principal.SessionID)
+	if err != nil {
+		logger.Infof("logout: RevokeSession: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	clearTokenCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
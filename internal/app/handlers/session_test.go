@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestUserHandler_RefreshToken(t *testing.T) {
+	tests := []struct {
+		name            string
+		cookie          string
+		needMockRotate  bool
+		mockRotate      *models.RefreshToken
+		mockRotateErr   error
+		expectedCode    int
+		expectedBody    string
+		isExpectedToken bool
+	}{
+		{
+			name:            "Valid refresh token",
+			cookie:          "old-token",
+			needMockRotate:  true,
+			mockRotate:      &models.RefreshToken{ID: 2, UserID: 1, SessionID: "sid"},
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"message":"Token refreshed"}`,
+			isExpectedToken: true,
+		},
+		{
+			name:         "Missing refresh token",
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: `{"error":"Refresh token is missing"}`,
+		},
+		{
+			name:           "Unknown or expired refresh token",
+			cookie:         "old-token",
+			needMockRotate: true,
+			mockRotateErr:  storage.ErrRefreshTokenInvalid,
+			expectedCode:   http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid refresh token"}`,
+		},
+		{
+			name:           "Reused refresh token",
+			cookie:         "old-token",
+			needMockRotate: true,
+			mockRotateErr:  storage.ErrRefreshTokenReused,
+			expectedCode:   http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid refresh token"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+			router.POST("/api/user/token/refresh", handler.RefreshToken)
+
+			if tt.isExpectedToken {
+				storageMock.On("GetUserByID", mock.Anything, tt.mockRotate.UserID).Return(&models.User{ID: tt.mockRotate.UserID, Login: "testuser"}, nil)
+			}
+
+			if tt.needMockRotate {
+				storageMock.On("RotateRefreshToken", mock.Anything, helpers.HashRefreshToken(tt.cookie), mock.Anything, mock.Anything).Return(tt.mockRotate, tt.mockRotateErr)
+			}
+
+			req, _ := http.NewRequest("POST", "/api/user/token/refresh", nil)
+			if len(tt.cookie) > 0 {
+				req.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			if tt.isExpectedToken {
+				cookies := map[string]string{}
+				for _, c := range w.Result().Cookies() {
+					cookies[c.Name] = c.Value
+				}
+
+				token, err := helpers.ValidateJWT(cookies[accessTokenCookie])
+				assert.NoError(t, err)
+
+				claims := token.(jwt.MapClaims)
+				assert.Equal(t, float64(tt.mockRotate.UserID), claims["id"])
+				assert.Equal(t, tt.mockRotate.SessionID, claims["sid"])
+				assert.Equal(t, "testuser", claims["login"])
+				assert.NotEmpty(t, cookies[refreshTokenCookie])
+				assert.NotEqual(t, tt.cookie, cookies[refreshTokenCookie])
+			}
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	storageMock := &storage.MockStorager{}
+	handler := NewUserHandler(storageMock, nil, nil)
+
+	router.Use(func(c *gin.Context) {
+		middleware.SetPrincipal(c, &middleware.Principal{UserID: 1, SessionID: "sid"})
+	})
+	router.POST("/api/user/logout", handler.Logout)
+
+	storageMock.On("RevokeSession", mock.Anything, "sid").Return(nil)
+
+	req, _ := http.NewRequest("POST", "/api/user/logout", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"message":"Logged out"}`, w.Body.String())
+
+	for _, c := range w.Result().Cookies() {
+		assert.Empty(t, c.Value)
+		assert.True(t, c.MaxAge < 0)
+	}
+
+	storageMock.AssertExpectations(t)
+}
+
+func TestUserHandler_AccessTokenAfterLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	storageMock := &storage.MockStorager{}
+	handler := NewUserHandler(storageMock, nil, nil)
+
+	userAPI := router.Group("/api/user", middleware.Auth(storageMock))
+	userAPI.POST("/logout", handler.Logout)
+	userAPI.GET("/orders", handler.GetOrders)
+
+	token, _ := helpers.NewAccessToken(1, "user", nil, "sid")
+
+	storageMock.On("IsSessionActive", mock.Anything, uint(1), "sid").Return(true, nil).Once()
+	storageMock.On("RevokeSession", mock.Anything, "sid").Return(nil)
+	storageMock.On("IsSessionActive", mock.Anything, uint(1), "sid").Return(false, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/api/user/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/user/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `{"error":"Session has ended"}`, w.Body.String())
+
+	storageMock.AssertExpectations(t)
+}
+
+func TestUserHandler_LoginReturnToken(t *testing.T) {
+	hash, _ := helpers.HashPassword("password")
+
+	tests := []struct {
+		name           string
+		query          string
+		isExpectedBody bool
+	}{
+		{
+			name:           "Token in body when requested",
+			query:          "?return_token=true",
+			isExpectedBody: true,
+		},
+		{
+			name:           "Token only in header by default",
+			query:          "",
+			isExpectedBody: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+			router.POST("/api/user/login", handler.Login)
+
+			storageMock.On("GetUserByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser", Password: hash}, nil)
+			storageMock.On("CreateRefreshToken", mock.Anything, uint(1), mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			req, _ := http.NewRequest("POST", "/api/user/login"+tt.query, strings.NewReader(`{"login":"testuser","password":"password"}`))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			header := w.Header().Get("Authorization")
+			assert.True(t, strings.HasPrefix(header, "Bearer "))
+
+			var body map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "Authentication successful", body["message"])
+
+			if tt.isExpectedBody {
+				assert.Equal(t, strings.TrimPrefix(header, "Bearer "), body["access_token"])
+				assert.NotEmpty(t, body["refresh_token"])
+				assert.Equal(t, "Bearer", body["token_type"])
+			} else {
+				assert.NotContains(t, body, "access_token")
+			}
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserHandler_RefreshTokenFromBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	storageMock := &storage.MockStorager{}
+	handler := NewUserHandler(storageMock, nil, nil)
+	router.POST("/api/user/token/refresh", handler.RefreshToken)
+
+	storageMock.On("RotateRefreshToken", mock.Anything, helpers.HashRefreshToken("old-token"), mock.Anything, mock.Anything).
+		Return(&models.RefreshToken{ID: 2, UserID: 1, SessionID: "sid"}, nil)
+	storageMock.On("GetUserByID", mock.Anything, uint(1)).Return(&models.User{ID: 1, Login: "testuser"}, nil)
+
+	req, _ := http.NewRequest("POST", "/api/user/token/refresh?return_token=true", strings.NewReader(`{"refresh_token":"old-token"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["access_token"])
+	assert.NotEqual(t, "old-token", body["refresh_token"])
+
+	storageMock.AssertExpectations(t)
+}
+
+type mockLoginLimiter struct {
+	mock.Mock
+}
+
+func (m *mockLoginLimiter) Check(ctx context.Context, login, ip string) (time.Duration, error) {
+	args := m.Called(ctx, login, ip)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *mockLoginLimiter) Failure(ctx context.Context, login, ip string) error {
+	args := m.Called(ctx, login, ip)
+	return args.Error(0)
+}
+
+func (m *mockLoginLimiter) Success(ctx context.Context, login string) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+func TestUserHandler_LoginLimiter(t *testing.T) {
+	hash, _ := helpers.HashPassword("password")
+
+	tests := []struct {
+		name               string
+		password           string
+		mockWait           time.Duration
+		mockWaitErr        error
+		needMockGetUser    bool
+		needMockFailure    bool
+		needMockSuccess    bool
+		expectedCode       int
+		expectedRetryAfter string
+	}{
+		{
+			name:               "Locked out",
+			password:           "password",
+			mockWait:           time.Millisecond * 1500,
+			expectedCode:       http.StatusTooManyRequests,
+			expectedRetryAfter: "2",
+		},
+		{
+			name:            "Wrong password is counted",
+			password:        "wrong",
+			needMockGetUser: true,
+			needMockFailure: true,
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			name:            "Success resets the counter",
+			password:        "password",
+			needMockGetUser: true,
+			needMockSuccess: true,
+			expectedCode:    http.StatusOK,
+		},
+		{
+			name:            "Broken limiter doesn't block logins",
+			password:        "password",
+			mockWaitErr:     errors.New("db is down"),
+			needMockGetUser: true,
+			needMockSuccess: true,
+			expectedCode:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			limiterMock := &mockLoginLimiter{}
+			handler := NewUserHandler(storageMock, nil, limiterMock)
+			router.POST("/api/user/login", handler.Login)
+
+			limiterMock.On("Check", mock.Anything, "testuser", "10.0.0.1").Return(tt.mockWait, tt.mockWaitErr)
+
+			if tt.needMockGetUser {
+				storageMock.On("GetUserByLogin", mock.Anything, "testuser").Return(&models.User{ID: 1, Login: "testuser", Password: hash}, nil)
+			}
+
+			if tt.needMockFailure {
+				limiterMock.On("Failure", mock.Anything, "testuser", "10.0.0.1").Return(nil)
+			}
+
+			if tt.needMockSuccess {
+				limiterMock.On("Success", mock.Anything, "testuser").Return(nil)
+				storageMock.On("CreateRefreshToken", mock.Anything, uint(1), mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			}
+
+			req, _ := http.NewRequest("POST", "/api/user/login", strings.NewReader(`{"login":"testuser","password":"`+tt.password+`"}`))
+			req.RemoteAddr = "10.0.0.1:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedRetryAfter, w.Header().Get("Retry-After"))
+
+			storageMock.AssertExpectations(t)
+			limiterMock.AssertExpectations(t)
+		})
+	}
+}
@@ -2,31 +2,43 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
 	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
 	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
 	"github.com/vtcaregorodtcev/gophermarket/internal/models"
 )
 
-type submitter interface {
-	Submit(task func())
+var dummyPasswordHash, _ = helpers.HashPassword("dummy password")
+
+type accrualQueue interface {
+	Enqueue(order *models.Order)
+}
+
+type loginLimiter interface {
+	Check(ctx context.Context, login, ip string) (time.Duration, error)
+	Failure(ctx context.Context, login, ip string) error
+	Success(ctx context.Context, login string) error
 }
 
 type UserHandler struct {
-	storage        storage.Storager
-	accrualService services.Accrualer
-	pool           submitter
+	storage storage.Storager
+	queue   accrualQueue
+	limiter loginLimiter
 }
 
-func NewUserHandler(storage storage.Storager, as services.Accrualer, wp submitter) *UserHandler {
-	return &UserHandler{storage: storage, accrualService: as, pool: wp}
+// NewUserHandler doesn't limit login attempts when limiter is nil.
+func NewUserHandler(storage storage.Storager, queue accrualQueue, limiter loginLimiter) *UserHandler {
+	return &UserHandler{storage: storage, queue: queue, limiter: limiter}
 }
 
 func (uh *UserHandler) Register(c *gin.Context) {
@@ -41,6 +53,13 @@ func (uh *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
+	newUser.Login = helpers.NormalizeLogin(newUser.Login)
+
+	if errs := helpers.ValidateCredentials(newUser.Login, newUser.Password); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credentials", "fields": errs})
+		return
+	}
+
 	existingUser, err := uh.storage.GetUserByLogin(nil, newUser.Login)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
@@ -51,21 +70,29 @@ func (uh *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := uh.storage.CreateUser(c.Request.Context(), newUser.Login, newUser.Password)
+	hash, err := helpers.HashPassword(newUser.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
 	}
 
-	jwt, err := helpers.GetJWTByID(user.ID)
+	user, err := uh.storage.CreateUser(c.Request.Context(), newUser.Login, hash)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		if err == storage.ErrLoginTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Login is already taken"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		}
 		return
 	}
 
-	c.SetCookie("jwt", jwt, 24*60*60, "/", "", false, false)
+	tokens, err := uh.startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User successfully registered and authenticated"})
+	respondWithTokens(c, "User successfully registered and authenticated", tokens)
 }
 
 func (uh *UserHandler) Login(c *gin.Context) {
@@ -80,25 +107,112 @@ func (uh *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	credentials.Login = helpers.NormalizeLogin(credentials.Login)
+
+	if wait := uh.loginWait(c, credentials.Login); wait > 0 {
+		lockedOut(c, wait)
+		return
+	}
+
 	user, err := uh.storage.GetUserByLogin(nil, credentials.Login)
-	if err != nil || user == nil || user.Password != credentials.Password {
+	if err != nil || user == nil {
+		// keep the response time the same as for a wrong password
+		helpers.VerifyPassword(dummyPasswordHash, credentials.Password)
+
+		uh.loginFailed(c, credentials.Login)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	jwt, err := helpers.GetJWTByID(user.ID)
+	ok, needsRehash := helpers.VerifyPassword(user.Password, credentials.Password)
+	if !ok {
+		uh.loginFailed(c, credentials.Login)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if uh.limiter != nil {
+		err = uh.limiter.Success(c.Request.Context(), credentials.Login)
+		if err != nil {
+			logger.Infof("login limiter: Success: %v", err)
+		}
+	}
+
+	if needsRehash {
+		uh.rehashPassword(c, user.ID, credentials.Password)
+	}
+
+	tokens, err := uh.startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
 	}
 
-	c.SetCookie("jwt", jwt, 24*60*60, "/", "", false, true)
+	respondWithTokens(c, "Authentication successful", tokens)
+}
+
+// loginWait fails open: a broken counter store must not lock everybody out.
+func (uh *UserHandler) loginWait(c *gin.Context, login string) time.Duration {
+	if uh.limiter == nil {
+		return 0
+	}
+
+	wait, err := uh.limiter.Check(c.Request.Context(), login, c.ClientIP())
+	if err != nil {
+		logger.Infof("login limiter: Check: %v", err)
+		return 0
+	}
+
+	return wait
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Authentication successful"})
+// lockedOut answers a password check refused by the login limiter.
+func lockedOut(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+}
+
+func (uh *UserHandler) loginFailed(c *gin.Context, login string) {
+	if uh.limiter == nil {
+		return
+	}
+
+	err := uh.limiter.Failure(c.Request.Context(), login, c.ClientIP())
+	if err != nil {
+		logger.Infof("login limiter: Failure: %v", err)
+	}
+}
+
+// currentPrincipal answers 401 itself when the request carries no principal,
+// so handlers can simply return.
+func currentPrincipal(c *gin.Context) (*middleware.Principal, bool) {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You must be logged in to access this resource"})
+	}
+
+	return principal, ok
+}
+
+func (uh *UserHandler) rehashPassword(c *gin.Context, userID uint, password string) {
+	hash, err := helpers.HashPassword(password)
+	if err != nil {
+		logger.Infof("rehash password: %v", err)
+		return
+	}
+
+	err = uh.storage.UpdateUserPassword(c.Request.Context(), userID, hash)
+	if err != nil {
+		logger.Infof("rehash password: UpdateUserPassword: %v", err)
+	}
 }
 
 func (uh *UserHandler) SubmitOrder(c *gin.Context) {
-	userID := c.MustGet("userID").(float64)
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -126,7 +240,7 @@ func (uh *UserHandler) SubmitOrder(c *gin.Context) {
 		return
 	}
 	if existingOrder != nil {
-		if existingOrder.UserID != uint(userID) {
+		if existingOrder.UserID != userID {
 			c.JSON(http.StatusConflict, gin.H{"error": "Order is already submitted"})
 		} else {
 			c.JSON(http.StatusOK, gin.H{"message": "Order is already submitted by this user"})
@@ -134,101 +248,148 @@ func (uh *UserHandler) SubmitOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := uh.storage.CreateOrder(c.Request.Context(), orderNumber, uint(userID))
+	order, err := uh.storage.CreateOrder(c.Request.Context(), orderNumber, userID)
 	if err != nil {
+		if err == storage.ErrUserNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
 	}
 
-	uh.calcAndApplyAccrual(order, uint(userID))
+	uh.queue.Enqueue(order)
 
 	c.JSON(http.StatusAccepted, order)
 }
 
-func (uh *UserHandler) calcAndApplyAccrual(order *models.Order, userID uint) {
-	uh.pool.Submit(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
-		defer cancel()
+func (uh *UserHandler) GetOrders(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
-		err := uh.storage.UpdateOrderStatus(ctx, order.ID, models.PROCESSING)
-		if err != nil {
-			logger.Infof("update order status: %v", err)
-		}
+	if hasListParams(c) {
+		uh.listOrders(c, userID)
+		return
+	}
 
-		resp, err := uh.accrualService.CalcOrderAccrual(ctx, order.Number)
-		if err != nil {
-			logger.Infof("submit order: CalcOrderAccrual: %v", err)
-			return
-		}
+	orders, err := uh.storage.GetOrdersByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve orders"})
+		return
+	}
 
-		err = uh.storage.UpdateOrderAccrualAndUserBalance(ctx, order.ID, userID, resp)
-		if err != nil {
-			logger.Infof("submit order: UpdateOrderAccrualAndUserBalance: %v", err)
-			return
-		}
+	if len(*orders) == 0 {
+		c.JSON(http.StatusNoContent, []models.Order{})
+		return
+	}
 
-		err = uh.storage.UpdateOrderStatus(ctx, order.ID, models.PROCESSED)
-		if err != nil {
-			logger.Infof("update order status: %v", err)
-		}
-	})
+	c.JSON(http.StatusOK, orders)
 }
 
-func (uh *UserHandler) GetOrders(c *gin.Context) {
-	userID := c.MustGet("userID").(float64)
+// listOrders serves GET /api/user/orders when the client opted into
+// filtering, sorting or paging.
+func (uh *UserHandler) listOrders(c *gin.Context, userID uint) {
+	statuses, ok := parseStatuses(c)
+	if !ok {
+		return
+	}
+
+	q, ok := parseListQuery(c, statuses)
+	if !ok {
+		return
+	}
 
-	orders, err := uh.storage.GetOrdersByUserID(uint(userID))
+	orders, err := uh.storage.GetOrders(c.Request.Context(), models.OrderFilter{
+		UserID:   userID,
+		Statuses: statuses,
+		From:     q.from,
+		To:       q.to,
+		Desc:     q.desc,
+		After:    q.after,
+		Limit:    q.fetchLimit(),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve orders"})
 		return
 	}
 
-	if len(*orders) == 0 {
+	page := *orders
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.UploadedAt), last.ID)) {
+			return
+		}
+	}
+
+	if len(page) == 0 {
 		c.JSON(http.StatusNoContent, []models.Order{})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	c.JSON(http.StatusOK, page)
 }
 
 func (uh *UserHandler) GetBalance(c *gin.Context) {
-	userID := c.MustGet("userID").(float64)
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
-	user, err := uh.storage.GetUserByID(nil, uint(userID), false)
+	user, err := uh.storage.GetUserByID(nil, userID, false)
 	if err != nil || user == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve User"})
 		return
 	}
 
 	type data struct {
-		Current   float64 `json:"current"`
-		Withdrawn float64 `json:"withdrawn"`
+		Current   models.Money `json:"current"`
+		Withdrawn models.Money `json:"withdrawn"`
 	}
 
 	c.JSON(http.StatusOK, data{Current: user.Balance, Withdrawn: user.Withdrawn})
 }
 
 type withdrawRequest struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string       `json:"order"`
+	Sum   models.Money `json:"sum"`
 }
 
 func (uh *UserHandler) WithdrawBalance(c *gin.Context) {
-	userID := c.MustGet("userID").(float64)
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	var req withdrawRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		if errors.Is(err, models.ErrMoneyPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sum must have at most two decimal places"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	err := uh.storage.WithdrawBalance(c.Request.Context(), uint(userID), req.Order, req.Sum)
+	if req.Sum <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sum must be positive"})
+		return
+	}
+
+	err := uh.storage.WithdrawBalance(c.Request.Context(), userID, req.Order, req.Sum)
 	if err != nil {
 		switch err {
 		case storage.ErrInsufficientBalance:
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient balance"})
 		case storage.ErrOrderAlreadyExists:
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Cannot proceed withdrawal with existing order"})
+		case storage.ErrUserNotFound:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		}
@@ -238,9 +399,18 @@ func (uh *UserHandler) WithdrawBalance(c *gin.Context) {
 }
 
 func (uh *UserHandler) GetWithdrawals(c *gin.Context) {
-	userID := c.MustGet("userID").(float64)
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+
+	if hasListParams(c) {
+		uh.listWithdrawals(c, userID)
+		return
+	}
 
-	withdrawals, err := uh.storage.GetUserWithdrawals(uint(userID))
+	withdrawals, err := uh.storage.GetUserWithdrawals(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
 		return
@@ -253,3 +423,101 @@ func (uh *UserHandler) GetWithdrawals(c *gin.Context) {
 
 	c.JSON(http.StatusOK, withdrawals)
 }
+
+// listWithdrawals serves GET /api/user/withdrawals when the client opted into
+// filtering, sorting or paging. Withdrawals have no status, so a status
+// parameter is rejected rather than silently ignored.
+func (uh *UserHandler) listWithdrawals(c *gin.Context, userID uint) {
+	if _, ok := c.GetQuery("status"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Withdrawals can't be filtered by status"})
+		return
+	}
+
+	q, ok := parseListQuery(c, nil)
+	if !ok {
+		return
+	}
+
+	withdrawals, err := uh.storage.GetWithdrawals(c.Request.Context(), models.WithdrawalFilter{
+		UserID: userID,
+		From:   q.from,
+		To:     q.to,
+		Desc:   q.desc,
+		After:  q.after,
+		Limit:  q.fetchLimit(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	page := *withdrawals
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.ProcessedAt), last.ID)) {
+			return
+		}
+	}
+
+	if len(page) == 0 {
+		c.JSON(http.StatusNoContent, []models.Withdrawal{})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetAdjustments lists manual balance corrections without revealing which
+// operator made them. The endpoint isn't part of the spec, so it is always
+// paged like the admin listings.
+func (uh *UserHandler) GetAdjustments(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := c.GetQuery("status"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustments can't be filtered by status"})
+		return
+	}
+
+	q, ok := parseListQuery(c, nil)
+	if !ok {
+		return
+	}
+
+	adjustments, err := uh.storage.GetBalanceAdjustments(c.Request.Context(), models.AdjustmentFilter{
+		UserID: principal.UserID,
+		From:   q.from,
+		To:     q.to,
+		Desc:   q.desc,
+		After:  q.after,
+		Limit:  q.fetchLimit(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+
+	page := *adjustments
+	if q.hasMore(len(page)) {
+		page = page[:q.limit]
+		last := page[len(page)-1]
+		if !setNextCursor(c, q.position(time.Time(last.CreatedAt), last.ID)) {
+			return
+		}
+	}
+
+	if len(page) == 0 {
+		c.JSON(http.StatusNoContent, []models.BalanceAdjustment{})
+		return
+	}
+
+	for _, adj := range page {
+		adj.UserID = 0
+		adj.OperatorID = 0
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -6,13 +6,15 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/middleware"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
 	"github.com/vtcaregorodtcev/gophermarket/internal/models"
 )
 
@@ -31,16 +33,64 @@ func TestUserHandler_Register(t *testing.T) {
 	}{
 		{
 			name:                   "Valid registration",
-			requestBody:            gin.H{"login": "testuser", "password": "password"},
+			requestBody:            gin.H{"login": "testuser", "password": "Str0ng-passw0rd"},
 			needMockGetUserByLogin: true,
 			mockGetUserByLogin:     nil,
 			mockGetUserByLoginErr:  nil,
 			needMockCreateUser:     true,
-			mockCreateUser:         &models.User{ID: 1, Login: "testuser", Password: "password"},
+			mockCreateUser:         &models.User{ID: 1, Login: "testuser"},
 			mockCreateUserErr:      nil,
 			expectedCode:           http.StatusOK,
 			expectedBody:           `{"message": "User successfully registered and authenticated"}`,
 		},
+		{
+			name:                   "Login is normalized",
+			requestBody:            gin.H{"login": " TestUser ", "password": "Str0ng-passw0rd"},
+			needMockGetUserByLogin: true,
+			mockGetUserByLogin:     nil,
+			mockGetUserByLoginErr:  nil,
+			needMockCreateUser:     true,
+			mockCreateUser:         &models.User{ID: 1, Login: "testuser"},
+			mockCreateUserErr:      nil,
+			expectedCode:           http.StatusOK,
+			expectedBody:           `{"message": "User successfully registered and authenticated"}`,
+		},
+		{
+			name:                   "Login taken concurrently",
+			requestBody:            gin.H{"login": "testuser", "password": "Str0ng-passw0rd"},
+			needMockGetUserByLogin: true,
+			mockGetUserByLogin:     nil,
+			mockGetUserByLoginErr:  nil,
+			needMockCreateUser:     true,
+			mockCreateUser:         nil,
+			mockCreateUserErr:      storage.ErrLoginTaken,
+			expectedCode:           http.StatusConflict,
+			expectedBody:           `{"error": "Login is already taken"}`,
+		},
+		{
+			name:         "Short password",
+			requestBody:  gin.H{"login": "testuser", "password": "Ab1"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error": "Invalid credentials", "fields": [{"field": "password", "message": "must be at least 8 characters long"}]}`,
+		},
+		{
+			name:         "Single character class",
+			requestBody:  gin.H{"login": "testuser", "password": "abcdefghij"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error": "Invalid credentials", "fields": [{"field": "password", "message": "must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"}]}`,
+		},
+		{
+			name:         "Common password",
+			requestBody:  gin.H{"login": "testuser", "password": "Password123"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error": "Invalid credentials", "fields": [{"field": "password", "message": "is too common"}]}`,
+		},
+		{
+			name:         "Invalid login",
+			requestBody:  gin.H{"login": "te st", "password": "Str0ng-passw0rd"},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error": "Invalid credentials", "fields": [{"field": "login", "message": "may contain only latin letters, digits, '.', '_' and '-' and must start with a letter or digit"}]}`,
+		},
 		{
 			name:                   "Empty credentials",
 			requestBody:            gin.H{"login": "", "password": ""},
@@ -55,7 +105,7 @@ func TestUserHandler_Register(t *testing.T) {
 		},
 		{
 			name:                   "Login already taken",
-			requestBody:            gin.H{"login": "existinguser", "password": "password"},
+			requestBody:            gin.H{"login": "existinguser", "password": "Str0ng-passw0rd"},
 			needMockGetUserByLogin: true,
 			mockGetUserByLogin:     &models.User{ID: 1, Login: "existinguser", Password: "password"},
 			mockGetUserByLoginErr:  nil,
@@ -67,7 +117,7 @@ func TestUserHandler_Register(t *testing.T) {
 		},
 		{
 			name:                   "Storage error",
-			requestBody:            gin.H{"login": "testuser", "password": "password"},
+			requestBody:            gin.H{"login": "testuser", "password": "Str0ng-passw0rd"},
 			needMockGetUserByLogin: true,
 			mockGetUserByLogin:     nil,
 			mockGetUserByLoginErr:  errors.New("Something went wrong"),
@@ -88,11 +138,20 @@ func TestUserHandler_Register(t *testing.T) {
 			router.POST("/api/user/register", handler.Register)
 
 			if tt.needMockGetUserByLogin {
-				storageMock.On("GetUserByLogin", mock.Anything, tt.requestBody.(gin.H)["login"]).Return(tt.mockGetUserByLogin, tt.mockGetUserByLoginErr)
+				storageMock.On("GetUserByLogin", mock.Anything, helpers.NormalizeLogin(tt.requestBody.(gin.H)["login"].(string))).Return(tt.mockGetUserByLogin, tt.mockGetUserByLoginErr)
 			}
 
 			if tt.needMockCreateUser {
-				storageMock.On("CreateUser", mock.Anything, tt.requestBody.(gin.H)["login"], tt.requestBody.(gin.H)["password"]).Return(tt.mockCreateUser, tt.mockCreateUserErr)
+				password := tt.requestBody.(gin.H)["password"].(string)
+				isHashed := mock.MatchedBy(func(hash string) bool {
+					ok, _ := helpers.VerifyPassword(hash, password)
+					return ok && hash != password
+				})
+				storageMock.On("CreateUser", mock.Anything, helpers.NormalizeLogin(tt.requestBody.(gin.H)["login"].(string)), isHashed).Return(tt.mockCreateUser, tt.mockCreateUserErr)
+			}
+
+			if tt.expectedCode == http.StatusOK {
+				storageMock.On("CreateRefreshToken", mock.Anything, tt.mockCreateUser.ID, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			}
 
 			jsonStr, _ := json.Marshal(tt.requestBody)
@@ -109,12 +168,15 @@ func TestUserHandler_Register(t *testing.T) {
 }
 
 func TestUserHandler_Login(t *testing.T) {
+	hash, _ := helpers.HashPassword("password")
+
 	tests := []struct {
 		name             string
 		requestBody      interface{}
 		needMockGetUser  bool
 		mockGetUser      *models.User
 		mockGetUserErr   error
+		needMockRehash   bool
 		expectedCode     int
 		expectedBody     string
 		isExpectedCookie bool
@@ -123,16 +185,45 @@ func TestUserHandler_Login(t *testing.T) {
 			name:            "Valid login",
 			requestBody:     gin.H{"login": "testuser", "password": "password"},
 			needMockGetUser: true,
+			mockGetUser: &models.User{
+				ID:       1,
+				Login:    "testuser",
+				Password: hash,
+			},
+			mockGetUserErr:   nil,
+			expectedCode:     http.StatusOK,
+			expectedBody:     `{"message": "Authentication successful"}`,
+			isExpectedCookie: true,
+		},
+		{
+			name:            "Legacy plaintext password is upgraded",
+			requestBody:     gin.H{"login": "testuser", "password": "password"},
+			needMockGetUser: true,
 			mockGetUser: &models.User{
 				ID:       1,
 				Login:    "testuser",
 				Password: "password",
 			},
 			mockGetUserErr:   nil,
+			needMockRehash:   true,
 			expectedCode:     http.StatusOK,
 			expectedBody:     `{"message": "Authentication successful"}`,
 			isExpectedCookie: true,
 		},
+		{
+			name:            "Wrong password",
+			requestBody:     gin.H{"login": "testuser", "password": "wrong"},
+			needMockGetUser: true,
+			mockGetUser: &models.User{
+				ID:       1,
+				Login:    "testuser",
+				Password: hash,
+			},
+			mockGetUserErr:   nil,
+			expectedCode:     http.StatusUnauthorized,
+			expectedBody:     `{"error": "Invalid credentials"}`,
+			isExpectedCookie: false,
+		},
 		{
 			name:             "Empty credentials",
 			requestBody:      gin.H{"login": "", "password": ""},
@@ -167,6 +258,18 @@ func TestUserHandler_Login(t *testing.T) {
 				storageMock.On("GetUserByLogin", mock.Anything, tt.requestBody.(gin.H)["login"]).Return(tt.mockGetUser, tt.mockGetUserErr)
 			}
 
+			if tt.needMockRehash {
+				isHashed := mock.MatchedBy(func(hash string) bool {
+					ok, needsRehash := helpers.VerifyPassword(hash, "password")
+					return ok && !needsRehash
+				})
+				storageMock.On("UpdateUserPassword", mock.Anything, tt.mockGetUser.ID, isHashed).Return(nil)
+			}
+
+			if tt.isExpectedCookie {
+				storageMock.On("CreateRefreshToken", mock.Anything, tt.mockGetUser.ID, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			}
+
 			jsonStr, _ := json.Marshal(tt.requestBody)
 			req, _ := http.NewRequest("POST", "/api/user/login", bytes.NewBuffer(jsonStr))
 			w := httptest.NewRecorder()
@@ -184,25 +287,25 @@ func TestUserHandler_Login(t *testing.T) {
 	}
 }
 
-type mockWorkerPool struct {
+type mockAccrualQueue struct {
 	mock.Mock
 }
 
-func (m *mockWorkerPool) Submit(f func()) {}
+func (m *mockAccrualQueue) Enqueue(order *models.Order) {
+	m.Called(order)
+}
 
 func TestUserHandler_SubmitOrder(t *testing.T) {
 	tests := []struct {
 		name        string
 		requestBody interface{}
-		userID      float64
+		userID      uint
 
 		needMockGetOrderByNumber bool
 		mockGetOrderByNumber     *models.Order
 		mockGetOrderErr          error
 
-		needMockUpdateOrderAccrualAndUserBalance bool
-		needMockCalcAccrual                      bool
-		mockCalcAccrual                          *services.CalcOrderAccrualResponse
+		needMockEnqueue bool
 
 		needMockCreateOrder bool
 		mockCreateOrder     *models.Order
@@ -212,20 +315,14 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 		expectedBody string
 	}{
 		{
-			name:                                     "Valid order submission",
-			requestBody:                              "123456789106",
-			userID:                                   1,
-			needMockGetOrderByNumber:                 true,
-			needMockCreateOrder:                      true,
-			needMockCalcAccrual:                      true,
-			needMockUpdateOrderAccrualAndUserBalance: true,
-			mockCalcAccrual: &services.CalcOrderAccrualResponse{
-				Order:   "123456789106",
-				Accrual: 100.0,
-				Status:  models.PROCESSED,
-			},
-			mockGetOrderByNumber: nil,
-			mockGetOrderErr:      nil,
+			name:                     "Valid order submission",
+			requestBody:              "123456789106",
+			userID:                   1,
+			needMockGetOrderByNumber: true,
+			needMockCreateOrder:      true,
+			needMockEnqueue:          true,
+			mockGetOrderByNumber:     nil,
+			mockGetOrderErr:          nil,
 			mockCreateOrder: &models.Order{
 				ID:     1,
 				Number: "123456789106",
@@ -276,6 +373,17 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 			expectedCode:       http.StatusConflict,
 			expectedBody:       `{"error": "Order is already submitted"}`,
 		},
+		{
+			name:                     "Deleted account",
+			requestBody:              "123456789106",
+			userID:                   1,
+			needMockGetOrderByNumber: true,
+			needMockCreateOrder:      true,
+			mockCreateOrder:          nil,
+			mockCreateOrderErr:       storage.ErrUserNotFound,
+			expectedCode:             http.StatusUnauthorized,
+			expectedBody:             `{"error": "Account no longer exists"}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -283,13 +391,12 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 			gin.SetMode(gin.TestMode)
 			router := gin.Default()
 			router.Use(func(c *gin.Context) {
-				c.Set("userID", tt.userID)
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: tt.userID})
 			})
 
 			storageMock := &storage.MockStorager{}
-			accrualServiceMock := &services.MockAccrualService{}
-			workerPoolMock := &mockWorkerPool{}
-			handler := NewUserHandler(storageMock, accrualServiceMock, workerPoolMock)
+			queueMock := &mockAccrualQueue{}
+			handler := NewUserHandler(storageMock, queueMock, nil)
 			router.POST("/api/user/orders", handler.SubmitOrder)
 
 			if tt.needMockGetOrderByNumber {
@@ -297,7 +404,11 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 			}
 
 			if tt.needMockCreateOrder {
-				storageMock.On("CreateOrder", mock.Anything, tt.requestBody, uint(tt.userID)).Return(tt.mockCreateOrder, tt.mockCreateOrderErr)
+				storageMock.On("CreateOrder", mock.Anything, tt.requestBody, tt.userID).Return(tt.mockCreateOrder, tt.mockCreateOrderErr)
+			}
+
+			if tt.needMockEnqueue {
+				queueMock.On("Enqueue", tt.mockCreateOrder).Return()
 			}
 
 			req, _ := http.NewRequest("POST", "/api/user/orders", bytes.NewBufferString(tt.requestBody.(string)))
@@ -308,6 +419,7 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 			assert.JSONEq(t, tt.expectedBody, w.Body.String())
 
 			storageMock.AssertExpectations(t)
+			queueMock.AssertExpectations(t)
 		})
 	}
 }
@@ -315,7 +427,7 @@ func TestUserHandler_SubmitOrder(t *testing.T) {
 func TestUserHandler_GetOrders(t *testing.T) {
 	tests := []struct {
 		name             string
-		userID           float64
+		userID           uint
 		mockGetOrders    *[]*models.Order
 		mockGetOrdersErr error
 		expectedCode     int
@@ -352,13 +464,13 @@ func TestUserHandler_GetOrders(t *testing.T) {
 			gin.SetMode(gin.TestMode)
 			router := gin.Default()
 			router.Use(func(c *gin.Context) {
-				c.Set("userID", tt.userID)
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: tt.userID})
 			})
 			storageMock := &storage.MockStorager{}
 			handler := NewUserHandler(storageMock, nil, nil)
 			router.GET("/api/user/orders", handler.GetOrders)
 
-			storageMock.On("GetOrdersByUserID", uint(tt.userID)).Return(tt.mockGetOrders, tt.mockGetOrdersErr)
+			storageMock.On("GetOrdersByUserID", tt.userID).Return(tt.mockGetOrders, tt.mockGetOrdersErr)
 
 			req, _ := http.NewRequest("GET", "/api/user/orders", nil)
 			w := httptest.NewRecorder()
@@ -379,7 +491,7 @@ func TestUserHandler_GetOrders(t *testing.T) {
 func TestUserHandler_GetBalance(t *testing.T) {
 	tests := []struct {
 		name               string
-		userID             float64
+		userID             uint
 		mockGetUserByID    *models.User
 		mockGetUserByIDErr error
 		expectedCode       int
@@ -388,7 +500,7 @@ func TestUserHandler_GetBalance(t *testing.T) {
 		{
 			name:               "Successful retrieval of balance",
 			userID:             1,
-			mockGetUserByID:    &models.User{ID: 1, Balance: 100.0, Withdrawn: 50.0},
+			mockGetUserByID:    &models.User{ID: 1, Balance: models.MustParseMoney("100"), Withdrawn: models.MustParseMoney("50")},
 			mockGetUserByIDErr: nil,
 			expectedCode:       http.StatusOK,
 			expectedBody:       `{"current":100,"withdrawn":50}`,
@@ -408,13 +520,13 @@ func TestUserHandler_GetBalance(t *testing.T) {
 			gin.SetMode(gin.TestMode)
 			router := gin.Default()
 			router.Use(func(c *gin.Context) {
-				c.Set("userID", tt.userID)
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: tt.userID})
 			})
 			storageMock := &storage.MockStorager{}
 			handler := NewUserHandler(storageMock, nil, nil)
 			router.GET("/api/user/balance", handler.GetBalance)
 
-			storageMock.On("GetUserByID", mock.Anything, uint(tt.userID)).Return(tt.mockGetUserByID, tt.mockGetUserByIDErr)
+			storageMock.On("GetUserByID", mock.Anything, tt.userID).Return(tt.mockGetUserByID, tt.mockGetUserByIDErr)
 
 			req, _ := http.NewRequest("GET", "/api/user/balance", nil)
 			w := httptest.NewRecorder()
@@ -431,7 +543,7 @@ func TestUserHandler_GetBalance(t *testing.T) {
 func TestUserHandler_WithdrawBalance(t *testing.T) {
 	tests := []struct {
 		name                   string
-		userID                 float64
+		userID                 uint
 		requestBody            interface{}
 		mockWithdrawBalanceErr error
 		expectedCode           int
@@ -440,7 +552,7 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 		{
 			name:                   "Successful withdrawal",
 			userID:                 1,
-			requestBody:            withdrawRequest{Order: "123456789", Sum: 50.0},
+			requestBody:            withdrawRequest{Order: "123456789", Sum: models.MustParseMoney("50")},
 			mockWithdrawBalanceErr: nil,
 			expectedCode:           http.StatusOK,
 			expectedBody:           `{"message":"Balance withdrawal successful"}`,
@@ -448,7 +560,7 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 		{
 			name:                   "Insufficient balance",
 			userID:                 1,
-			requestBody:            withdrawRequest{Order: "123456789", Sum: 50.0},
+			requestBody:            withdrawRequest{Order: "123456789", Sum: models.MustParseMoney("50")},
 			mockWithdrawBalanceErr: storage.ErrInsufficientBalance,
 			expectedCode:           http.StatusPaymentRequired,
 			expectedBody:           `{"error":"Insufficient balance"}`,
@@ -456,7 +568,7 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 		{
 			name:                   "Cannot proceed withdrawal with existing order",
 			userID:                 1,
-			requestBody:            withdrawRequest{Order: "123456789", Sum: 50.0},
+			requestBody:            withdrawRequest{Order: "123456789", Sum: models.MustParseMoney("50")},
 			mockWithdrawBalanceErr: storage.ErrOrderAlreadyExists,
 			expectedCode:           http.StatusPaymentRequired,
 			expectedBody:           `{"error":"Cannot proceed withdrawal with existing order"}`,
@@ -464,7 +576,7 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 		{
 			name:                   "Internal server error",
 			userID:                 1,
-			requestBody:            withdrawRequest{Order: "123456789", Sum: 50.0},
+			requestBody:            withdrawRequest{Order: "123456789", Sum: models.MustParseMoney("50")},
 			mockWithdrawBalanceErr: errors.New("Internal server error"),
 			expectedCode:           http.StatusInternalServerError,
 			expectedBody:           `{"error":"Internal server error"}`,
@@ -479,12 +591,12 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 			handler := NewUserHandler(storageMock, nil, nil)
 
 			router.Use(func(c *gin.Context) {
-				c.Set("userID", tt.userID)
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: tt.userID})
 			})
 
 			router.POST("/api/user/balance/withdraw", handler.WithdrawBalance)
 
-			storageMock.On("WithdrawBalance", mock.Anything, uint(tt.userID), tt.requestBody.(withdrawRequest).Order, tt.requestBody.(withdrawRequest).Sum).Return(tt.mockWithdrawBalanceErr)
+			storageMock.On("WithdrawBalance", mock.Anything, tt.userID, tt.requestBody.(withdrawRequest).Order, tt.requestBody.(withdrawRequest).Sum).Return(tt.mockWithdrawBalanceErr)
 
 			jsonStr, _ := json.Marshal(tt.requestBody)
 			req, _ := http.NewRequest("POST", "/api/user/balance/withdraw", bytes.NewBuffer(jsonStr))
@@ -500,10 +612,64 @@ func TestUserHandler_WithdrawBalance(t *testing.T) {
 	}
 }
 
+func TestUserHandler_WithdrawBalanceInvalidSum(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedBody string
+	}{
+		{
+			name:         "Too many decimal places",
+			body:         `{"order":"123456789","sum":10.001}`,
+			expectedBody: `{"error":"Sum must have at most two decimal places"}`,
+		},
+		{
+			name:         "Zero sum",
+			body:         `{"order":"123456789","sum":0}`,
+			expectedBody: `{"error":"Sum must be positive"}`,
+		},
+		{
+			name:         "Negative sum",
+			body:         `{"order":"123456789","sum":-5}`,
+			expectedBody: `{"error":"Sum must be positive"}`,
+		},
+		{
+			name:         "Sum as a string",
+			body:         `{"order":"123456789","sum":"10"}`,
+			expectedBody: `{"error":"Invalid request format"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			storageMock := &storage.MockStorager{}
+			handler := NewUserHandler(storageMock, nil, nil)
+
+			router.Use(func(c *gin.Context) {
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: 1})
+			})
+
+			router.POST("/api/user/balance/withdraw", handler.WithdrawBalance)
+
+			req, _ := http.NewRequest("POST", "/api/user/balance/withdraw", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
 func TestUserHandler_GetWithdrawals(t *testing.T) {
 	tests := []struct {
 		name                      string
-		userID                    float64
+		userID                    uint
 		mockGetUserWithdrawals    *[]*models.Withdrawal
 		mockGetUserWithdrawalsErr error
 		expectedCode              int
@@ -512,7 +678,7 @@ func TestUserHandler_GetWithdrawals(t *testing.T) {
 		{
 			name:                      "Successful retrieval",
 			userID:                    1,
-			mockGetUserWithdrawals:    &[]*models.Withdrawal{{OrderNumber: "123456789", Sum: 50.0}, {OrderNumber: "123456783", Sum: 250.0}},
+			mockGetUserWithdrawals:    &[]*models.Withdrawal{{OrderNumber: "123456789", Sum: models.MustParseMoney("50")}, {OrderNumber: "123456783", Sum: models.MustParseMoney("250")}},
 			mockGetUserWithdrawalsErr: nil,
 			expectedCode:              http.StatusOK,
 			expectedBody:              `[{"order":"123456789","sum":50,"processed_at":"0001-01-01T00:00:00Z"},{"order":"123456783","sum":250,"processed_at":"0001-01-01T00:00:00Z"}]`,
@@ -535,12 +701,12 @@ func TestUserHandler_GetWithdrawals(t *testing.T) {
 			handler := NewUserHandler(storageMock, nil, nil)
 
 			router.Use(func(c *gin.Context) {
-				c.Set("userID", tt.userID)
+				middleware.SetPrincipal(c, &middleware.Principal{UserID: tt.userID})
 			})
 
 			router.GET("/api/user/withdrawals", handler.GetWithdrawals)
 
-			storageMock.On("GetUserWithdrawals", uint(tt.userID)).Return(tt.mockGetUserWithdrawals, tt.mockGetUserWithdrawalsErr)
+			storageMock.On("GetUserWithdrawals", tt.userID).Return(tt.mockGetUserWithdrawals, tt.mockGetUserWithdrawalsErr)
 
 			req, _ := http.NewRequest("GET", "/api/user/withdrawals", nil)
 			w := httptest.NewRecorder()
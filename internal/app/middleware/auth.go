@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
@@ -9,9 +12,16 @@ import (
 	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
 )
 
-func Auth() gin.HandlerFunc {
+// SessionValidator tells whether the session an access token was issued for
+// is still live, so logging out or revoking a session takes effect before
+// the token expires.
+type SessionValidator interface {
+	IsSessionActive(ctx context.Context, userID uint, sessionID string) (bool, error)
+}
+
+func Auth(sessions SessionValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString, err := c.Cookie("jwt")
+		tokenString, err := tokenFromRequest(c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "You must be logged in to access this resource"})
 			c.Abort()
@@ -25,7 +35,42 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("userID", claims.(jwt.MapClaims)["id"])
+		principal, err := ParsePrincipal(claims.(jwt.MapClaims))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		active, err := sessions.IsSessionActive(c.Request.Context(), principal.UserID, principal.SessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			c.Abort()
+			return
+		}
+
+		SetPrincipal(c, principal)
 		c.Next()
 	}
 }
+
+// tokenFromRequest prefers the Authorization header over the jwt cookie so
+// API clients don't have to deal with cookies at all.
+func tokenFromRequest(c *gin.Context) (string, error) {
+	header := c.GetHeader("Authorization")
+	if len(header) > 0 {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || len(strings.TrimSpace(token)) == 0 {
+			return "", errors.New("malformed Authorization header")
+		}
+
+		return strings.TrimSpace(token), nil
+	}
+
+	return c.Cookie("jwt")
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+type fakeSessions struct {
+	active bool
+	err    error
+}
+
+func (s fakeSessions) IsSessionActive(ctx context.Context, userID uint, sessionID string) (bool, error) {
+	return s.active, s.err
+}
+
+func TestAuth(t *testing.T) {
+	token, _ := helpers.NewAccessToken(7, "user7", []string{"support"}, "sid")
+
+	tests := []struct {
+		name         string
+		header       string
+		cookie       string
+		sessions     *fakeSessions
+		expectedCode int
+	}{
+		{
+			name:         "Bearer token",
+			header:       "Bearer " + token,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Lowercase scheme",
+			header:       "bearer " + token,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Cookie",
+			cookie:       token,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Header wins over cookie",
+			header:       "Bearer " + token,
+			cookie:       "garbage",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Wrong scheme",
+			header:       "Basic " + token,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Invalid token",
+			header:       "Bearer garbage",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "No credentials",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Revoked session",
+			header:       "Bearer " + token,
+			sessions:     &fakeSessions{active: false},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Session lookup failed",
+			header:       "Bearer " + token,
+			sessions:     &fakeSessions{err: errors.New("db is down")},
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			sessions := fakeSessions{active: true}
+			if tt.sessions != nil {
+				sessions = *tt.sessions
+			}
+
+			router := gin.New()
+			router.GET("/", Auth(sessions), func(c *gin.Context) {
+				p, ok := GetPrincipal(c)
+				assert.True(t, ok)
+				assert.Equal(t, uint(7), p.UserID)
+				assert.Equal(t, "user7", p.Login)
+				assert.Equal(t, "sid", p.SessionID)
+				assert.Equal(t, []string{"support"}, p.Roles)
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			if len(tt.header) > 0 {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if len(tt.cookie) > 0 {
+				req.AddCookie(&http.Cookie{Name: "jwt", Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestParsePrincipal(t *testing.T) {
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"id": float64(1), "login": "user", "sid": "sid", "jti": "jti"}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(jwt.MapClaims)
+		expected *Principal
+	}{
+		{
+			name:     "Valid claims",
+			modify:   func(jwt.MapClaims) {},
+			expected: &Principal{UserID: 1, Login: "user", SessionID: "sid", TokenID: "jti"},
+		},
+		{
+			name:     "With roles",
+			modify:   func(c jwt.MapClaims) { c["roles"] = []interface{}{"admin"} },
+			expected: &Principal{UserID: 1, Login: "user", SessionID: "sid", TokenID: "jti", Roles: []string{"admin"}},
+		},
+		{
+			name:     "Null roles",
+			modify:   func(c jwt.MapClaims) { c["roles"] = nil },
+			expected: &Principal{UserID: 1, Login: "user", SessionID: "sid", TokenID: "jti"},
+		},
+		{
+			name:   "String id",
+			modify: func(c jwt.MapClaims) { c["id"] = "1" },
+		},
+		{
+			name:   "Missing id",
+			modify: func(c jwt.MapClaims) { delete(c, "id") },
+		},
+		{
+			name:   "Fractional id",
+			modify: func(c jwt.MapClaims) { c["id"] = 1.5 },
+		},
+		{
+			name:   "Zero id",
+			modify: func(c jwt.MapClaims) { c["id"] = float64(0) },
+		},
+		{
+			name:   "Missing session",
+			modify: func(c jwt.MapClaims) { delete(c, "sid") },
+		},
+		{
+			name:   "Login of wrong type",
+			modify: func(c jwt.MapClaims) { c["login"] = 42 },
+		},
+		{
+			name:   "Roles of wrong type",
+			modify: func(c jwt.MapClaims) { c["roles"] = "admin" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+
+			p, err := ParsePrincipal(claims)
+			if tt.expected == nil {
+				assert.ErrorIs(t, err, ErrMalformedClaims)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, p)
+		})
+	}
+}
+
+func TestGetPrincipalWithoutAuth(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	p, ok := GetPrincipal(c)
+	assert.False(t, ok)
+	assert.Nil(t, p)
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		principal    *Principal
+		expectedCode int
+	}{
+		{
+			name:         "Has the role",
+			principal:    &Principal{UserID: 1, Roles: []string{"support"}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Has another accepted role",
+			principal:    &Principal{UserID: 1, Roles: []string{"admin"}},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "No roles",
+			principal:    &Principal{UserID: 1},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Not authenticated",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.principal != nil {
+					SetPrincipal(c, tt.principal)
+				}
+			})
+			router.GET("/", RequireRole("support", "admin"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+var ErrMalformedClaims = errors.New("malformed token claims")
+
+// Principal is the authenticated user a request is made on behalf of.
+type Principal struct {
+	UserID    uint
+	Login     string
+	Roles     []string
+	SessionID string
+	TokenID   string
+}
+
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal returns the principal set by Auth. It reports false instead of
+// panicking when the route isn't behind Auth.
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+
+	p, ok := v.(*Principal)
+	if !ok || p == nil {
+		return nil, false
+	}
+
+	return p, true
+}
+
+// ParsePrincipal builds a principal from validated token claims and rejects
+// tokens whose claims are missing or have unexpected types.
+func ParsePrincipal(claims jwt.MapClaims) (*Principal, error) {
+	id, ok := claims["id"].(float64)
+	if !ok || id < 1 || id > math.MaxUint32 || id != math.Trunc(id) {
+		return nil, ErrMalformedClaims
+	}
+
+	p := &Principal{UserID: uint(id)}
+
+	for name, dst := range map[string]*string{"login": &p.Login, "sid": &p.SessionID, "jti": &p.TokenID} {
+		v, ok := claims[name].(string)
+		if !ok || len(v) == 0 {
+			return nil, ErrMalformedClaims
+		}
+		*dst = v
+	}
+
+	// tokens of users without roles carry "roles": null
+	if raw, ok := claims["roles"]; ok && raw != nil {
+		roles, ok := raw.([]interface{})
+		if !ok {
+			return nil, ErrMalformedClaims
+		}
+
+		for _, r := range roles {
+			role, ok := r.(string)
+			if !ok {
+				return nil, ErrMalformedClaims
+			}
+			p.Roles = append(p.Roles, role)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,279 @@
+package poller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type submitter interface {
+	Submit(task func())
+}
+
+type Config struct {
+	// Interval is both the idle polling period and the delay before an
+	// order that is still being calculated is checked again.
+	Interval time.Duration
+	// BatchSize caps how many jobs this instance holds at once.
+	BatchSize int
+	Timeout   time.Duration
+	// Lease is how long a claimed job stays invisible to other workers.
+	// It must be longer than Timeout.
+	Lease time.Duration
+	// MaxBackoff caps the exponential delay after transient failures.
+	MaxBackoff time.Duration
+	// UnknownGrace is how long an order the accrual system doesn't know
+	// about is retried before it is marked INVALID.
+	UnknownGrace time.Duration
+	// RecoveryBatch and RecoveryPause throttle the startup sweep so a big
+	// backlog is fed to the queue gradually.
+	RecoveryBatch int
+	RecoveryPause time.Duration
+}
+
+// Poller works off the persistent accrual job queue and keeps asking the
+// accrual system about every order until it sees INVALID or PROCESSED.
+type Poller struct {
+	cfg            Config
+	storage        storage.Storager
+	accrualService services.Accrualer
+	pool           submitter
+
+	active atomic.Int32
+	wake   chan struct{}
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func New(cfg Config, storage storage.Storager, as services.Accrualer, pool submitter) *Poller {
+	return &Poller{
+		cfg:            cfg,
+		storage:        storage,
+		accrualService: as,
+		pool:           pool,
+		wake:           make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+}
+
+func (p *Poller) Run() {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// Recover re-enqueues orders left in NEW or PROCESSING without an open job,
+// e.g. ones submitted right before a restart.
+func (p *Poller) Recover() {
+	total := 0
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+		n, err := p.storage.RecoverAccrualJobs(ctx, p.cfg.RecoveryBatch)
+		cancel()
+
+		if err != nil {
+			logger.Infof("poller: RecoverAccrualJobs: %v", err)
+			break
+		}
+
+		total += n
+		if n < p.cfg.RecoveryBatch {
+			break
+		}
+
+		logger.Infof("poller: recovered %d orders so far, continuing", total)
+		p.notify()
+
+		select {
+		case <-p.done:
+			logger.Infof("poller: recovery interrupted after %d orders", total)
+			return
+		case <-time.After(p.cfg.RecoveryPause):
+		}
+	}
+
+	logger.Infof("poller: recovery finished, %d orders re-enqueued", total)
+	if total > 0 {
+		p.notify()
+	}
+}
+
+func (p *Poller) Stop() {
+	p.stopOnce.Do(func() { close(p.done) })
+}
+
+// Enqueue wakes the poller so a freshly stored order is picked up without
+// waiting for the next tick. The job itself is persisted with the order.
+func (p *Poller) Enqueue(order *models.Order) {
+	p.notify()
+}
+
+func (p *Poller) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Poller) poll() {
+	free := p.cfg.BatchSize - int(p.active.Load())
+	if free <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+
+	jobs, err := p.storage.ClaimAccrualJobs(ctx, free, p.cfg.Lease)
+	if err != nil {
+		logger.Infof("poller: ClaimAccrualJobs: %v", err)
+		return
+	}
+
+	for _, job := range *jobs {
+		job := job
+
+		p.active.Add(1)
+		p.pool.Submit(func() {
+			defer p.active.Add(-1)
+
+			p.process(job)
+		})
+	}
+}
+
+func (p *Poller) process(job *models.AccrualJob) {
+	order := &job.Order
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	res := p.accrualService.CalcOrderAccrual(callCtx, order.Number)
+	callCancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+
+	p.recordAttempt(ctx, order, res)
+
+	switch res.Outcome {
+	case services.AccrualFinal:
+		err := p.storage.UpdateOrderAccrualAndUserBalance(ctx, order.ID, order.UserID, res.Response)
+		if err != nil {
+			logger.Infof("poller: UpdateOrderAccrualAndUserBalance: %v", err)
+			p.retry(ctx, job, p.backoff(job.Attempts), err)
+			return
+		}
+
+		p.complete(ctx, job)
+	case services.AccrualPending:
+		err := p.updateStatus(ctx, order, models.PROCESSING)
+		p.retry(ctx, job, p.cfg.Interval, err)
+	case services.AccrualUnknown:
+		age := time.Since(time.Time(order.UploadedAt))
+		if age < p.cfg.UnknownGrace {
+			p.retry(ctx, job, p.cfg.Interval, nil)
+			return
+		}
+
+		logger.Infof("poller: order %s is unknown to accrual system for %s, marking invalid", order.Number, age)
+		err := p.updateStatus(ctx, order, models.INVALID)
+		if err != nil {
+			p.retry(ctx, job, p.backoff(job.Attempts), err)
+			return
+		}
+
+		p.complete(ctx, job)
+	case services.AccrualRateLimited, services.AccrualCircuitOpen:
+		p.retry(ctx, job, res.RetryAfter, res.Err)
+	default:
+		logger.Infof("poller: CalcOrderAccrual for order %s: %s: %v", order.Number, res.Outcome, res.Err)
+		p.retry(ctx, job, p.backoff(job.Attempts), res.Err)
+	}
+}
+
+// recordAttempt keeps the history support looks at when an accrual is late.
+func (p *Poller) recordAttempt(ctx context.Context, order *models.Order, res *services.AccrualResult) {
+	attempt := &models.AccrualAttempt{OrderID: order.ID, Outcome: res.Outcome.String()}
+
+	if res.Response != nil {
+		status, accrual := res.Response.Status, res.Response.Accrual
+		attempt.Status = &status
+		attempt.Accrual = &accrual
+	}
+
+	if res.Err != nil {
+		msg := res.Err.Error()
+		attempt.Error = &msg
+	}
+
+	err := p.storage.RecordAccrualAttempt(ctx, attempt)
+	if err != nil {
+		logger.Infof("poller: RecordAccrualAttempt: %v", err)
+	}
+}
+
+func (p *Poller) backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	if attempts > 16 {
+		return p.cfg.MaxBackoff
+	}
+
+	d := p.cfg.Interval << (attempts - 1)
+	if d > p.cfg.MaxBackoff {
+		return p.cfg.MaxBackoff
+	}
+
+	return d
+}
+
+func (p *Poller) complete(ctx context.Context, job *models.AccrualJob) {
+	err := p.storage.CompleteAccrualJob(ctx, job.ID)
+	if err != nil {
+		logger.Infof("poller: CompleteAccrualJob: %v", err)
+	}
+}
+
+func (p *Poller) retry(ctx context.Context, job *models.AccrualJob, delay time.Duration, cause error) {
+	lastError := ""
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	err := p.storage.RescheduleAccrualJob(ctx, job.ID, delay, lastError)
+	if err != nil {
+		logger.Infof("poller: RescheduleAccrualJob: %v", err)
+	}
+}
+
+func (p *Poller) updateStatus(ctx context.Context, order *models.Order, status models.OrderStatus) error {
+	if order.Status == status {
+		return nil
+	}
+
+	err := p.storage.UpdateOrderStatus(ctx, order.ID, status)
+	if err != nil {
+		logger.Infof("poller: update order status: %v", err)
+	}
+
+	return err
+}
@@ -0,0 +1,226 @@
+package poller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/storage"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type syncPool struct{}
+
+func (syncPool) Submit(task func()) { task() }
+
+func TestPoller_Process(t *testing.T) {
+	processed := &services.CalcOrderAccrualResponse{Order: "123456789106", Accrual: models.MustParseMoney("100"), Status: models.PROCESSED}
+	cfg := Config{
+		Interval:     time.Second,
+		BatchSize:    4,
+		Timeout:      time.Second,
+		Lease:        time.Minute,
+		MaxBackoff:   time.Second * 10,
+		UnknownGrace: time.Minute * 10,
+	}
+
+	tests := []struct {
+		name           string
+		status         models.OrderStatus
+		attempts       int
+		uploadedAgo    time.Duration
+		result         *services.AccrualResult
+		expectAccrual  bool
+		expectedStatus models.OrderStatus
+		expectComplete bool
+		expectedDelay  time.Duration
+		expectedError  string
+	}{
+		{
+			name:           "Final result is applied",
+			status:         models.PROCESSING,
+			result:         &services.AccrualResult{Outcome: services.AccrualFinal, Response: processed},
+			expectAccrual:  true,
+			expectComplete: true,
+		},
+		{
+			name:           "Pending result moves new order to processing",
+			status:         models.NEW,
+			result:         &services.AccrualResult{Outcome: services.AccrualPending},
+			expectedStatus: models.PROCESSING,
+			expectedDelay:  cfg.Interval,
+		},
+		{
+			name:          "Pending result keeps processing order untouched",
+			status:        models.PROCESSING,
+			result:        &services.AccrualResult{Outcome: services.AccrualPending},
+			expectedDelay: cfg.Interval,
+		},
+		{
+			name:          "Unknown order within grace period is retried",
+			status:        models.NEW,
+			uploadedAgo:   time.Minute,
+			result:        &services.AccrualResult{Outcome: services.AccrualUnknown},
+			expectedDelay: cfg.Interval,
+		},
+		{
+			name:           "Unknown order past grace period is invalidated",
+			status:         models.NEW,
+			uploadedAgo:    time.Hour,
+			result:         &services.AccrualResult{Outcome: services.AccrualUnknown},
+			expectedStatus: models.INVALID,
+			expectComplete: true,
+		},
+		{
+			name:          "Rate limited job waits for Retry-After",
+			status:        models.NEW,
+			result:        &services.AccrualResult{Outcome: services.AccrualRateLimited, RetryAfter: time.Minute, Err: services.ErrTooManyRequests},
+			expectedDelay: time.Minute,
+			expectedError: services.ErrTooManyRequests.Error(),
+		},
+		{
+			name:          "Job rejected by open circuit breaker is rescheduled",
+			status:        models.NEW,
+			result:        &services.AccrualResult{Outcome: services.AccrualCircuitOpen, RetryAfter: time.Second * 30, Err: services.ErrCircuitOpen},
+			expectedDelay: time.Second * 30,
+			expectedError: services.ErrCircuitOpen.Error(),
+		},
+		{
+			name:          "Transient failure backs off exponentially",
+			status:        models.NEW,
+			attempts:      3,
+			result:        &services.AccrualResult{Outcome: services.AccrualTransient, Err: errors.New("boom")},
+			expectedDelay: time.Second * 4,
+			expectedError: "boom",
+		},
+		{
+			name:          "Transient failure backoff is capped",
+			status:        models.NEW,
+			attempts:      10,
+			result:        &services.AccrualResult{Outcome: services.AccrualTransient, Err: errors.New("boom")},
+			expectedDelay: cfg.MaxBackoff,
+			expectedError: "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := &storage.MockStorager{}
+			accrualMock := &services.MockAccrualService{}
+			p := New(cfg, storageMock, accrualMock, syncPool{})
+
+			job := &models.AccrualJob{
+				ID:       7,
+				Attempts: tt.attempts,
+				Order: models.Order{
+					ID:         1,
+					UserID:     2,
+					Number:     "123456789106",
+					Status:     tt.status,
+					UploadedAt: helpers.RFC3339Time(time.Now().Add(-tt.uploadedAgo)),
+				},
+			}
+
+			storageMock.On("ClaimAccrualJobs", mock.Anything, cfg.BatchSize, cfg.Lease).Return(&[]*models.AccrualJob{job}, nil)
+			accrualMock.On("CalcOrderAccrual", mock.Anything, job.Order.Number).Return(tt.result)
+
+			isAttempt := mock.MatchedBy(func(a *models.AccrualAttempt) bool {
+				return a.OrderID == job.Order.ID && a.Outcome == tt.result.Outcome.String()
+			})
+			storageMock.On("RecordAccrualAttempt", mock.Anything, isAttempt).Return(nil)
+
+			if tt.expectAccrual {
+				storageMock.On("UpdateOrderAccrualAndUserBalance", mock.Anything, job.Order.ID, job.Order.UserID, tt.result.Response).Return(nil)
+			}
+
+			if tt.expectedStatus != "" {
+				storageMock.On("UpdateOrderStatus", mock.Anything, job.Order.ID, tt.expectedStatus).Return(nil)
+			}
+
+			if tt.expectComplete {
+				storageMock.On("CompleteAccrualJob", mock.Anything, job.ID).Return(nil)
+			} else {
+				storageMock.On("RescheduleAccrualJob", mock.Anything, job.ID, tt.expectedDelay, tt.expectedError).Return(nil)
+			}
+
+			p.poll()
+
+			accrualMock.AssertExpectations(t)
+			storageMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPoller_Recover(t *testing.T) {
+	cfg := Config{
+		Timeout:       time.Second,
+		RecoveryBatch: 2,
+		RecoveryPause: time.Millisecond,
+	}
+
+	tests := []struct {
+		name          string
+		batches       []int
+		err           error
+		expectWake    bool
+		expectedCalls int
+	}{
+		{name: "Nothing to recover", batches: []int{0}, expectedCalls: 1},
+		{name: "Partial batch finishes the sweep", batches: []int{1}, expectWake: true, expectedCalls: 1},
+		{name: "Full batches are followed by another one", batches: []int{2, 2, 1}, expectWake: true, expectedCalls: 3},
+		{name: "Full batch followed by an empty one", batches: []int{2, 0}, expectWake: true, expectedCalls: 2},
+		{name: "Error stops the sweep", batches: []int{2}, err: errors.New("boom"), expectWake: true, expectedCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageMock := &storage.MockStorager{}
+			p := New(cfg, storageMock, &services.MockAccrualService{}, syncPool{})
+
+			for _, n := range tt.batches {
+				storageMock.On("RecoverAccrualJobs", mock.Anything, cfg.RecoveryBatch).Return(n, nil).Once()
+			}
+			if tt.err != nil {
+				storageMock.On("RecoverAccrualJobs", mock.Anything, cfg.RecoveryBatch).Return(0, tt.err).Once()
+			}
+
+			p.Recover()
+
+			storageMock.AssertExpectations(t)
+			storageMock.AssertNumberOfCalls(t, "RecoverAccrualJobs", tt.expectedCalls)
+
+			select {
+			case <-p.wake:
+				assert.True(t, tt.expectWake, "poller was woken up")
+			default:
+				assert.False(t, tt.expectWake, "poller was not woken up")
+			}
+		})
+	}
+}
+
+func TestPoller_RecoverStops(t *testing.T) {
+	storageMock := &storage.MockStorager{}
+	p := New(Config{Timeout: time.Second, RecoveryBatch: 2, RecoveryPause: time.Hour}, storageMock, &services.MockAccrualService{}, syncPool{})
+
+	storageMock.On("RecoverAccrualJobs", mock.Anything, 2).Return(2, nil).Once()
+	p.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		p.Recover()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recovery did not stop")
+	}
+
+	storageMock.AssertExpectations(t)
+}
@@ -3,56 +3,215 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
 	"github.com/vtcaregorodtcev/gophermarket/internal/models"
 )
 
 type Accrualer interface {
-	CalcOrderAccrual(ctx context.Context, orderNumber string) (*CalcOrderAccrualResponse, error)
+	CalcOrderAccrual(ctx context.Context, orderNumber string) *AccrualResult
+}
+
+var (
+	ErrTooManyRequests = errors.New("accrual system rate limit exceeded")
+	// ErrThrottled means the call wasn't made: the rate limit learned from
+	// earlier 429s wouldn't let it through before its deadline.
+	ErrThrottled = errors.New("accrual calls are throttled after a rate limit")
+)
+
+type AccrualOutcome int
+
+const (
+	// AccrualFinal means the order reached INVALID or PROCESSED.
+	AccrualFinal AccrualOutcome = iota
+	// AccrualPending means the order is REGISTERED or PROCESSING.
+	AccrualPending
+	// AccrualUnknown means the accrual system doesn't know the order yet (204).
+	AccrualUnknown
+	// AccrualRateLimited means the accrual system answered 429.
+	AccrualRateLimited
+	// AccrualTransient covers network errors, 5xx and malformed responses.
+	AccrualTransient
+	// AccrualCircuitOpen means the call was rejected without reaching the
+	// accrual system because it has been failing.
+	AccrualCircuitOpen
+)
+
+func (o AccrualOutcome) String() string {
+	switch o {
+	case AccrualFinal:
+		return "final"
+	case AccrualPending:
+		return "pending"
+	case AccrualUnknown:
+		return "unknown"
+	case AccrualRateLimited:
+		return "rate_limited"
+	case AccrualCircuitOpen:
+		return "circuit_open"
+	default:
+		return "transient"
+	}
+}
+
+type AccrualResult struct {
+	Outcome    AccrualOutcome
+	Response   *CalcOrderAccrualResponse
+	RetryAfter time.Duration
+	Err        error
+}
+
+func transient(err error) *AccrualResult {
+	return &AccrualResult{Outcome: AccrualTransient, Err: err}
 }
 
 type AccrualService struct {
-	addr string
+	addr       string
+	client     *http.Client
+	authHeader string
+	authValue  string
+	throttle   *Throttle
+	breaker    *CircuitBreaker
 }
 
-func NewAccrualService(addr string) *AccrualService {
-	return &AccrualService{addr: addr}
+func NewAccrualService(addr string, opts ...AccrualOption) (*AccrualService, error) {
+	cfg := &accrualConfig{timeout: time.Second * 10}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccrualService{
+		addr:       addr,
+		client:     client,
+		authHeader: cfg.authHeader,
+		authValue:  cfg.authValue,
+		throttle:   AccrualThrottle,
+		breaker:    NewCircuitBreaker(5, time.Second*30),
+	}, nil
 }
 
 type CalcOrderAccrualResponse struct {
 	Order   string             `json:"order"`
-	Accrual float64            `json:"accrual"`
+	Accrual models.Money       `json:"accrual"`
 	Status  models.OrderStatus `json:"status"`
 }
 
-func (s *AccrualService) CalcOrderAccrual(ctx context.Context, orderNumber string) (*CalcOrderAccrualResponse, error) {
+// UnmarshalJSON rounds the accrual to hundredths instead of rejecting it: the
+// accrual system may compute amounts like 36.499, and refusing them would
+// retry the order forever without ever crediting it.
+func (r *CalcOrderAccrualResponse) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Order   string             `json:"order"`
+		Accrual json.Number        `json:"accrual"`
+		Status  models.OrderStatus `json:"status"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var accrual models.Money
+	if len(raw.Accrual) > 0 {
+		var err error
+		if accrual, err = models.RoundMoney(raw.Accrual.String()); err != nil {
+			return fmt.Errorf("invalid accrual %s: %w", raw.Accrual, err)
+		}
+	}
+
+	*r = CalcOrderAccrualResponse{Order: raw.Order, Accrual: accrual, Status: raw.Status}
+
+	return nil
+}
+
+func (s *AccrualService) CalcOrderAccrual(ctx context.Context, orderNumber string) *AccrualResult {
 	url := fmt.Sprintf("%s/api/orders/%s", s.addr, orderNumber)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return transient(err)
+	}
+
+	if len(s.authHeader) > 0 {
+		req.Header.Set(s.authHeader, s.authValue)
+	}
+
+	if ok, wait := s.breaker.Allow(); !ok {
+		return &AccrualResult{Outcome: AccrualCircuitOpen, RetryAfter: wait, Err: ErrCircuitOpen}
 	}
 
-	client := http.DefaultClient
-	resp, err := client.Do(req)
+	// waiting out a pause longer than the call may take would only hold the
+	// worker until the deadline, so the job is rescheduled past it instead
+	if deadline, ok := ctx.Deadline(); ok {
+		if delay := s.throttle.Delay(); time.Now().Add(delay).After(deadline) {
+			s.breaker.Release()
+			return &AccrualResult{Outcome: AccrualRateLimited, RetryAfter: delay, Err: ErrThrottled}
+		}
+	}
+
+	err = s.throttle.Wait(ctx)
 	if err != nil {
-		return nil, err
+		// ctx ended first, e.g. the pause was extended; nothing was sent
+		s.breaker.Release()
+		return &AccrualResult{Outcome: AccrualRateLimited, RetryAfter: s.throttle.Delay(), Err: ErrThrottled}
+	}
+
+	res := s.do(req)
+	switch res.Outcome {
+	case AccrualTransient:
+		s.breaker.Failure()
+	case AccrualRateLimited:
+		// the service is alive but busy, which neither proves nor disproves
+		// that it recovered
+		s.breaker.Release()
+	default:
+		s.breaker.Success()
+	}
+
+	return res
+}
+
+func (s *AccrualService) do(req *http.Request) *AccrualResult {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return transient(err)
 	}
 	defer resp.Body.Close()
 
 	logger.Infof("CalcOrderAccrual response status: %d", resp.StatusCode)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return &AccrualResult{Outcome: AccrualUnknown}
+	case http.StatusTooManyRequests:
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		s.throttle.Pause(retryAfter)
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if n := parseRateLimit(string(body)); n > 0 {
+			s.throttle.SetRate(n)
+		}
+
+		logger.Infof("CalcOrderAccrual: rate limited, pausing accrual calls for %s", retryAfter)
+		return &AccrualResult{Outcome: AccrualRateLimited, RetryAfter: retryAfter, Err: ErrTooManyRequests}
+	default:
+		return transient(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
 	var response CalcOrderAccrualResponse
 
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return nil, err
+		return transient(err)
 	}
 
 	r, err := json.Marshal(response)
@@ -60,5 +219,12 @@ func (s *AccrualService) CalcOrderAccrual(ctx context.Context, orderNumber strin
 		logger.Infof("CalcOrderAccrual response: %s", r)
 	}
 
-	return &response, nil
+	switch response.Status {
+	case models.PROCESSED, models.INVALID:
+		return &AccrualResult{Outcome: AccrualFinal, Response: &response}
+	case models.REGISTERED, models.PROCESSING:
+		return &AccrualResult{Outcome: AccrualPending, Response: &response}
+	default:
+		return transient(fmt.Errorf("unexpected accrual status: %s", response.Status))
+	}
 }
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestCalcOrderAccrualRoundsAccrual(t *testing.T) {
+	tests := []struct {
+		name    string
+		accrual string
+		outcome AccrualOutcome
+		money   models.Money
+	}{
+		{name: "Two decimal places", accrual: "729.98", outcome: AccrualFinal, money: models.MustParseMoney("729.98")},
+		{name: "More decimal places are rounded", accrual: "36.499", outcome: AccrualFinal, money: models.MustParseMoney("36.5")},
+		{name: "Exponent form", accrual: "1.5e2", outcome: AccrualFinal, money: models.MustParseMoney("150")},
+		{name: "Not a number", accrual: `"a lot"`, outcome: AccrualTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"order":"123456789106","status":"PROCESSED","accrual":%s}`, tt.accrual)
+			}))
+			defer server.Close()
+
+			as, err := NewAccrualService(server.URL)
+			assert.NoError(t, err)
+
+			res := as.CalcOrderAccrual(context.Background(), "123456789106")
+			assert.Equal(t, tt.outcome, res.Outcome)
+
+			if tt.outcome == AccrualFinal {
+				assert.Equal(t, tt.money, res.Response.Accrual)
+				assert.Equal(t, models.PROCESSED, res.Response.Status)
+			}
+		})
+	}
+}
+
+func TestCalcOrderAccrualWithoutAccrual(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"order":"123456789106","status":"INVALID"}`)
+	}))
+	defer server.Close()
+
+	as, err := NewAccrualService(server.URL)
+	assert.NoError(t, err)
+
+	res := as.CalcOrderAccrual(context.Background(), "123456789106")
+	assert.Equal(t, AccrualFinal, res.Outcome)
+	assert.Equal(t, models.Money(0), res.Response.Accrual)
+}
+
+func TestCalcOrderAccrualRateLimitedProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	as, err := NewAccrualService(server.URL)
+	assert.NoError(t, err)
+	as.throttle = NewThrottle()
+	as.breaker = NewCircuitBreaker(1, time.Millisecond*20)
+
+	as.breaker.Failure()
+	time.Sleep(time.Millisecond * 25)
+
+	res := as.CalcOrderAccrual(context.Background(), "123456789106")
+	assert.Equal(t, AccrualRateLimited, res.Outcome)
+	assert.Equal(t, BreakerHalfOpen, as.breaker.State(), "a 429 probe doesn't close the breaker")
+
+	ok, _ := as.breaker.Allow()
+	assert.True(t, ok, "the probe slot is free again")
+}
+
+func TestCalcOrderAccrualPausedPastDeadline(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		processedOrder(w, r)
+	}))
+	defer server.Close()
+
+	as, err := NewAccrualService(server.URL)
+	assert.NoError(t, err)
+	as.throttle = NewThrottle()
+	as.breaker = NewCircuitBreaker(1, time.Millisecond*20)
+
+	// a half-open probe slot taken by the skipped call must be given back
+	as.breaker.Failure()
+	time.Sleep(time.Millisecond * 25)
+
+	as.throttle.Pause(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	res := as.CalcOrderAccrual(ctx, "123456789106")
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "the call didn't wait for the pause")
+
+	assert.Equal(t, AccrualRateLimited, res.Outcome)
+	assert.ErrorIs(t, res.Err, ErrThrottled)
+	assert.Greater(t, res.RetryAfter, 59*time.Second)
+	assert.LessOrEqual(t, res.RetryAfter, time.Minute)
+	assert.Equal(t, 0, requests)
+
+	assert.Equal(t, BreakerHalfOpen, as.breaker.State())
+	ok, _ := as.breaker.Allow()
+	assert.True(t, ok)
+}
+
+func TestCalcOrderAccrualWaitsOutShortPause(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(processedOrder))
+	defer server.Close()
+
+	as, err := NewAccrualService(server.URL)
+	assert.NoError(t, err)
+	as.throttle = NewThrottle()
+	as.throttle.Pause(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	res := as.CalcOrderAccrual(ctx, "123456789106")
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.Equal(t, AccrualFinal, res.Outcome)
+}
+
+func TestCalcOrderAccrualCircuitOpenSkipsThrottle(t *testing.T) {
+	as, err := NewAccrualService("http://localhost")
+	assert.NoError(t, err)
+	as.throttle = NewThrottle()
+	as.throttle.SetRate(1)
+	as.breaker = NewCircuitBreaker(1, time.Minute)
+	as.breaker.Failure()
+
+	res := as.CalcOrderAccrual(context.Background(), "123456789106")
+	assert.Equal(t, AccrualCircuitOpen, res.Outcome)
+	assert.Equal(t, time.Duration(0), as.throttle.Delay(), "no slot was reserved")
+}
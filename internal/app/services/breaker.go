@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+)
+
+var ErrCircuitOpen = errors.New("accrual system circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+var breakerMetrics = expvar.NewMap("accrual_circuit_breaker")
+
+// CircuitBreaker opens after threshold consecutive failures and rejects
+// calls until openTimeout passes. Then a single probe is let through: its
+// success closes the breaker, its failure opens it again, and a Release
+// lets another probe through.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	threshold   int
+	openTimeout time.Duration
+	openedAt    time.Time
+	probing     bool
+}
+
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{threshold: threshold, openTimeout: openTimeout}
+	b.publish()
+
+	return b
+}
+
+// Allow reports whether a call may proceed. When it may not, it also returns
+// how long until the next probe is allowed.
+func (b *CircuitBreaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		wait := b.openTimeout - time.Since(b.openedAt)
+		if wait > 0 {
+			breakerMetrics.Add("rejected", 1)
+			return false, wait
+		}
+
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true, 0
+	case BreakerHalfOpen:
+		if b.probing {
+			breakerMetrics.Add("rejected", 1)
+			return false, b.openTimeout
+		}
+
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+	b.publish()
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+		breakerMetrics.Add("opened", 1)
+	}
+	b.publish()
+}
+
+// Release ends an allowed call that says nothing about the health of the
+// accrual system, like a 429. Neither the state nor the failure count
+// changes, only the half-open probe slot is freed.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	logger.Infof("accrual circuit breaker: %s -> %s after %d consecutive failures", b.state, state, b.failures)
+	b.state = state
+	b.publish()
+}
+
+// BreakerMetrics returns a snapshot of the breaker counters and state. Only
+// this map is exposed, not the whole expvar registry, which also publishes
+// the command line with its secrets.
+func BreakerMetrics() map[string]interface{} {
+	metrics := make(map[string]interface{})
+
+	breakerMetrics.Do(func(kv expvar.KeyValue) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &v); err == nil {
+			metrics[kv.Key] = v
+		}
+	})
+
+	return metrics
+}
+
+func (b *CircuitBreaker) publish() {
+	state := new(expvar.String)
+	state.Set(b.state.String())
+	breakerMetrics.Set("state", state)
+
+	failures := new(expvar.Int)
+	failures.Set(int64(b.failures))
+	breakerMetrics.Set("consecutive_failures", failures)
+}
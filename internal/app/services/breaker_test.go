@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Millisecond*20)
+
+	ok, _ := b.Allow()
+	assert.True(t, ok)
+	b.Failure()
+	assert.Equal(t, BreakerClosed, b.State())
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+
+	ok, wait := b.Allow()
+	assert.False(t, ok)
+	assert.True(t, wait > 0)
+
+	time.Sleep(time.Millisecond * 25)
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+
+	ok, _ = b.Allow()
+	assert.False(t, ok, "only one probe is allowed while half-open")
+
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(time.Millisecond * 25)
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+}
+
+func TestBreakerMetrics(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Minute)
+	b.Failure()
+
+	metrics := BreakerMetrics()
+	assert.Equal(t, "open", metrics["state"])
+	assert.NotContains(t, metrics, "cmdline")
+	assert.NotContains(t, metrics, "memstats")
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Millisecond*20)
+
+	ok, _ := b.Allow()
+	assert.True(t, ok)
+	b.Failure()
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	b.Release()
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// the released call didn't reset the count, one more failure opens
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(time.Millisecond * 25)
+
+	ok, _ = b.Allow()
+	assert.True(t, ok)
+	b.Release()
+	assert.Equal(t, BreakerHalfOpen, b.State(), "a released probe doesn't close the breaker")
+
+	ok, _ = b.Allow()
+	assert.True(t, ok, "a released probe frees the slot for the next one")
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+type accrualConfig struct {
+	timeout      time.Duration
+	maxIdleConns int
+	caFile       string
+	certFile     string
+	keyFile      string
+	authHeader   string
+	authValue    string
+}
+
+type AccrualOption func(*accrualConfig)
+
+// WithTimeout limits a single request to the accrual system, including
+// reading the response body.
+func WithTimeout(timeout time.Duration) AccrualOption {
+	return func(cfg *accrualConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+func WithMaxIdleConns(n int) AccrualOption {
+	return func(cfg *accrualConfig) {
+		cfg.maxIdleConns = n
+	}
+}
+
+// WithCACert trusts the PEM bundle at file in addition to the system roots.
+func WithCACert(file string) AccrualOption {
+	return func(cfg *accrualConfig) {
+		cfg.caFile = file
+	}
+}
+
+// WithClientCert presents the certificate for mTLS.
+func WithClientCert(certFile, keyFile string) AccrualOption {
+	return func(cfg *accrualConfig) {
+		cfg.certFile = certFile
+		cfg.keyFile = keyFile
+	}
+}
+
+// WithAuthHeader adds the header to every request, e.g. an API key.
+func WithAuthHeader(name, value string) AccrualOption {
+	return func(cfg *accrualConfig) {
+		cfg.authHeader = name
+		cfg.authValue = value
+	}
+}
+
+func newHTTPClient(cfg *accrualConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.maxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.maxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.maxIdleConns
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(cfg.caFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(cfg.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read accrual CA bundle: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in accrual CA bundle %s", cfg.caFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(cfg.certFile) > 0 || len(cfg.keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load accrual client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport, Timeout: cfg.timeout}, nil
+}
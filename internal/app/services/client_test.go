@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAccrualTLSServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, string) {
+	server := httptest.NewUnstartedServer(handler)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	return server, caFile
+}
+
+func writePEM(t *testing.T, file, kind string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newClientCert writes a self-signed client certificate and its key and
+// returns their paths along with the parsed certificate.
+func newClientCert(t *testing.T, cn string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	return certFile, keyFile, cert
+}
+
+func processedOrder(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, `{"order":"123456789106","status":"PROCESSED","accrual":500}`)
+}
+
+func TestAccrualServiceTrustsCustomCA(t *testing.T) {
+	server, caFile := newAccrualTLSServer(t, processedOrder)
+
+	as, err := NewAccrualService(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualTransient, as.CalcOrderAccrual(context.Background(), "123456789106").Outcome)
+
+	as, err = NewAccrualService(server.URL, WithCACert(caFile))
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualFinal, as.CalcOrderAccrual(context.Background(), "123456789106").Outcome)
+}
+
+func TestAccrualServicePresentsClientCert(t *testing.T) {
+	certFile, keyFile, clientCert := newClientCert(t, "gophermart")
+
+	var presented string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = r.TLS.PeerCertificates[0].Subject.CommonName
+		processedOrder(w, r)
+	}))
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	as, err := NewAccrualService(server.URL, WithCACert(caFile))
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualTransient, as.CalcOrderAccrual(context.Background(), "123456789106").Outcome)
+
+	as, err = NewAccrualService(server.URL, WithCACert(caFile), WithClientCert(certFile, keyFile))
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualFinal, as.CalcOrderAccrual(context.Background(), "123456789106").Outcome)
+	assert.Equal(t, "gophermart", presented)
+}
+
+func TestAccrualServiceSendsAuthHeader(t *testing.T) {
+	var got string
+	server, caFile := newAccrualTLSServer(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Api-Key")
+		processedOrder(w, r)
+	})
+
+	as, err := NewAccrualService(server.URL, WithCACert(caFile), WithAuthHeader("X-Api-Key", "secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, AccrualFinal, as.CalcOrderAccrual(context.Background(), "123456789106").Outcome)
+	assert.Equal(t, "secret", got)
+}
+
+func TestNewAccrualServiceInvalidTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile, _ := newClientCert(t, "gophermart")
+
+	tests := []struct {
+		name string
+		opt  AccrualOption
+	}{
+		{name: "Missing CA bundle", opt: WithCACert(filepath.Join(dir, "missing.pem"))},
+		{name: "CA bundle without certificates", opt: WithCACert(garbage)},
+		{name: "Missing client certificate", opt: WithClientCert(filepath.Join(dir, "missing.pem"), keyFile)},
+		{name: "Missing client key", opt: WithClientCert(certFile, filepath.Join(dir, "missing.pem"))},
+		{name: "Key without certificate", opt: WithClientCert("", keyFile)},
+		{name: "Invalid client certificate", opt: WithClientCert(garbage, keyFile)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, err := NewAccrualService("https://localhost", tt.opt)
+			assert.Error(t, err)
+			assert.Nil(t, as)
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+)
+
+const (
+	LockoutKindLogin = "login"
+	LockoutKindIP    = "ip"
+)
+
+// LoginAttemptStore keeps failed login counters. MemoryAttemptStore is enough
+// for a single instance, several instances have to share a Postgres one.
+type LoginAttemptStore interface {
+	// LoginLockedUntil returns the zero time when key isn't locked.
+	LoginLockedUntil(ctx context.Context, key string) (time.Time, error)
+	// AddLoginFailure returns the number of failures for key, starting over
+	// when the previous failure is older than window.
+	AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+type LockoutAuditor interface {
+	RecordLoginLockout(ctx context.Context, kind, subject string, failures int, until time.Time) error
+}
+
+// LockoutPolicy delays every failure after FreeAttempts exponentially,
+// starting at BaseDelay, and locks the key for LockoutDuration once
+// LockoutThreshold failures are reached.
+type LockoutPolicy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+}
+
+var (
+	DefaultLoginPolicy = LockoutPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute * 5,
+		LockoutThreshold: 10,
+		LockoutDuration:  time.Minute * 15,
+		Window:           time.Minute * 15,
+	}
+	// DefaultIPPolicy is looser since many users may share an address.
+	DefaultIPPolicy = LockoutPolicy{
+		FreeAttempts:     20,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute * 5,
+		LockoutThreshold: 100,
+		LockoutDuration:  time.Minute * 15,
+		Window:           time.Minute * 15,
+	}
+)
+
+func (p LockoutPolicy) delay(failures int) (time.Duration, bool) {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration, true
+	}
+
+	n := failures - p.FreeAttempts
+	if n <= 0 {
+		return 0, false
+	}
+
+	if n > 16 {
+		return p.MaxDelay, false
+	}
+
+	d := p.BaseDelay << (n - 1)
+	if d > p.MaxDelay {
+		return p.MaxDelay, false
+	}
+
+	return d, false
+}
+
+type LoginLimiter struct {
+	store   LoginAttemptStore
+	auditor LockoutAuditor
+	login   LockoutPolicy
+	ip      LockoutPolicy
+	now     func() time.Time
+}
+
+func NewLoginLimiter(store LoginAttemptStore, auditor LockoutAuditor, login, ip LockoutPolicy) *LoginLimiter {
+	return &LoginLimiter{
+		store:   store,
+		auditor: auditor,
+		login:   login,
+		ip:      ip,
+		now:     time.Now,
+	}
+}
+
+type limiterKey struct {
+	kind    string
+	subject string
+	policy  LockoutPolicy
+}
+
+func (l *LoginLimiter) keys(login, ip string) []limiterKey {
+	keys := []limiterKey{{kind: LockoutKindLogin, subject: strings.ToLower(login), policy: l.login}}
+	if len(ip) > 0 {
+		keys = append(keys, limiterKey{kind: LockoutKindIP, subject: ip, policy: l.ip})
+	}
+
+	return keys
+}
+
+func (k limiterKey) String() string {
+	return k.kind + ":" + k.subject
+}
+
+// Check returns how long the caller has to wait before the next attempt for
+// this login from this address is allowed.
+func (l *LoginLimiter) Check(ctx context.Context, login, ip string) (time.Duration, error) {
+	var wait time.Duration
+
+	for _, key := range l.keys(login, ip) {
+		until, err := l.store.LoginLockedUntil(ctx, key.String())
+		if err != nil {
+			return 0, err
+		}
+
+		if d := until.Sub(l.now()); d > wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+func (l *LoginLimiter) Failure(ctx context.Context, login, ip string) error {
+	for _, key := range l.keys(login, ip) {
+		failures, err := l.store.AddLoginFailure(ctx, key.String(), key.policy.Window)
+		if err != nil {
+			return err
+		}
+
+		d, lockout := key.policy.delay(failures)
+		if d <= 0 {
+			continue
+		}
+
+		until := l.now().Add(d)
+
+		err = l.store.LockLogin(ctx, key.String(), until)
+		if err != nil {
+			return err
+		}
+
+		// only the failure that crosses the threshold is audited, later
+		// ones just extend the lockout
+		if lockout && failures == key.policy.LockoutThreshold {
+			logger.Infof("login limiter: %s locked until %s after %d failures", key, until.Format(time.RFC3339), failures)
+
+			if l.auditor != nil {
+				err = l.auditor.RecordLoginLockout(ctx, key.kind, key.subject, failures, until)
+				if err != nil {
+					logger.Infof("login limiter: RecordLoginLockout: %v", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Success forgets the failures of the login. The address counter is kept so
+// a valid account can't be used to reset it.
+func (l *LoginLimiter) Success(ctx context.Context, login string) error {
+	return l.store.ResetLoginFailures(ctx, l.keys(login, "")[0].String())
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]*loginAttempts)}
+}
+
+func (s *MemoryAttemptStore) LoginLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok {
+		return a.lockedUntil, nil
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *MemoryAttemptStore) AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now, window)
+
+	a, ok := s.attempts[key]
+	if !ok {
+		a = &loginAttempts{}
+		s.attempts[key] = a
+	}
+
+	if now.Sub(a.lastFailure) > window {
+		a.failures = 0
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	return a.failures, nil
+}
+
+func (s *MemoryAttemptStore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		a = &loginAttempts{}
+		s.attempts[key] = a
+	}
+
+	if until.After(a.lockedUntil) {
+		a.lockedUntil = until
+	}
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) ResetLoginFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+// sweep drops counters that are neither locked nor inside the window so the
+// map doesn't grow with every login ever tried.
+func (s *MemoryAttemptStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+
+	for key, a := range s.attempts {
+		if now.Sub(a.lastFailure) > window && now.After(a.lockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
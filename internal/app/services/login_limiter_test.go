@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lockoutRecord struct {
+	kind     string
+	subject  string
+	failures int
+}
+
+type fakeAuditor struct {
+	records []lockoutRecord
+}
+
+func (a *fakeAuditor) RecordLoginLockout(ctx context.Context, kind, subject string, failures int, until time.Time) error {
+	a.records = append(a.records, lockoutRecord{kind: kind, subject: subject, failures: failures})
+	return nil
+}
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	p := LockoutPolicy{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Second * 5,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		delay    time.Duration
+		lockout  bool
+	}{
+		{failures: 1, delay: 0},
+		{failures: 2, delay: 0},
+		{failures: 3, delay: time.Second},
+		{failures: 4, delay: time.Second * 2},
+		{failures: 5, delay: time.Second * 4},
+		{failures: 6, delay: time.Minute, lockout: true},
+		{failures: 7, delay: time.Minute, lockout: true},
+	}
+
+	for _, tt := range tests {
+		delay, lockout := p.delay(tt.failures)
+		assert.Equal(t, tt.delay, delay, "failures: %d", tt.failures)
+		assert.Equal(t, tt.lockout, lockout, "failures: %d", tt.failures)
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	ctx := context.Background()
+	auditor := &fakeAuditor{}
+
+	login := LockoutPolicy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 3, LockoutDuration: time.Hour, Window: time.Hour}
+	ip := LockoutPolicy{FreeAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 20, LockoutDuration: time.Hour, Window: time.Hour}
+
+	l := NewLoginLimiter(NewMemoryAttemptStore(), auditor, login, ip)
+
+	assert.NoError(t, l.Failure(ctx, "User", "10.0.0.1"))
+	wait, err := l.Check(ctx, "user", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Zero(t, wait, "first failure is free")
+
+	assert.NoError(t, l.Failure(ctx, "user", "10.0.0.1"))
+	wait, _ = l.Check(ctx, "user", "10.0.0.2")
+	assert.True(t, wait > 0 && wait <= time.Second, "login is delayed from any address")
+
+	wait, _ = l.Check(ctx, "other", "10.0.0.1")
+	assert.Zero(t, wait, "address isn't delayed yet")
+
+	assert.NoError(t, l.Failure(ctx, "user", "10.0.0.1"))
+	wait, _ = l.Check(ctx, "user", "10.0.0.1")
+	assert.True(t, wait > time.Minute, "login is locked out")
+	assert.Equal(t, []lockoutRecord{{kind: LockoutKindLogin, subject: "user", failures: 3}}, auditor.records)
+
+	assert.NoError(t, l.Failure(ctx, "user", "10.0.0.1"))
+	assert.Len(t, auditor.records, 1, "lockout is audited once")
+
+	assert.NoError(t, l.Success(ctx, "user"))
+	wait, _ = l.Check(ctx, "user", "10.0.0.1")
+	assert.Zero(t, wait)
+}
+
+func TestMemoryAttemptStoreWindow(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryAttemptStore()
+
+	n, _ := s.AddLoginFailure(ctx, "k", time.Millisecond*10)
+	assert.Equal(t, 1, n)
+	n, _ = s.AddLoginFailure(ctx, "k", time.Millisecond*10)
+	assert.Equal(t, 2, n)
+
+	time.Sleep(time.Millisecond * 15)
+
+	n, _ = s.AddLoginFailure(ctx, "k", time.Millisecond*10)
+	assert.Equal(t, 1, n, "counter starts over after the window")
+}
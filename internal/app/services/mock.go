@@ -10,7 +10,7 @@ type MockAccrualService struct {
 	mock.Mock
 }
 
-func (m *MockAccrualService) CalcOrderAccrual(ctx context.Context, orderNumber string) (*CalcOrderAccrualResponse, error) {
-	args := m.Called()
-	return nil, args.Error(0)
+func (m *MockAccrualService) CalcOrderAccrual(ctx context.Context, orderNumber string) *AccrualResult {
+	args := m.Called(ctx, orderNumber)
+	return args.Get(0).(*AccrualResult)
 }
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type BalanceReconciler interface {
+	ReconcileBalances(ctx context.Context) (*[](*models.BalanceDrift), error)
+}
+
+// Reconciler periodically checks the cached user balances against the ledger
+// and reports every user whose balance drifted. Nothing is fixed
+// automatically: drift means a bug or a manual edit someone has to look at.
+type Reconciler struct {
+	store    BalanceReconciler
+	interval time.Duration
+	timeout  time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewReconciler(store BalanceReconciler, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		store:    store,
+		interval: interval,
+		timeout:  time.Minute,
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Reconciler) Run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		_, _ = r.Check(ctx)
+		cancel()
+	}
+}
+
+func (r *Reconciler) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+// Check runs a single reconciliation and logs what it found.
+func (r *Reconciler) Check(ctx context.Context) ([](*models.BalanceDrift), error) {
+	drifts, err := r.store.ReconcileBalances(ctx)
+	if err != nil {
+		logger.Infof("balance reconciliation failed: %v", err)
+		return nil, err
+	}
+
+	for _, d := range *drifts {
+		logger.Infof(
+			"balance drift: userID: %d, balance: %s, ledger balance: %s, withdrawn: %s, ledger withdrawn: %s",
+			d.UserID, d.Balance, d.LedgerBalance, d.Withdrawn, d.LedgerWithdrawn)
+	}
+
+	if len(*drifts) == 0 {
+		logger.Infof("balance reconciliation: no drift")
+	}
+
+	return *drifts, nil
+}
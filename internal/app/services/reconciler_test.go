@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type fakeReconcileStore struct {
+	drifts []*models.BalanceDrift
+	err    error
+	calls  int
+}
+
+func (s *fakeReconcileStore) ReconcileBalances(ctx context.Context) (*[](*models.BalanceDrift), error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &s.drifts, nil
+}
+
+func TestReconcilerCheck(t *testing.T) {
+	drift := &models.BalanceDrift{UserID: 1, Login: "alice", Balance: models.MustParseMoney("10"), LedgerBalance: models.MustParseMoney("7.5")}
+
+	store := &fakeReconcileStore{drifts: []*models.BalanceDrift{drift}}
+	r := NewReconciler(store, time.Hour)
+
+	drifts, err := r.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.BalanceDrift{drift}, drifts)
+
+	store.err = errors.New("db is down")
+
+	drifts, err = r.Check(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, drifts)
+	assert.Equal(t, 2, store.calls)
+}
+
+func TestReconcilerStop(t *testing.T) {
+	r := NewReconciler(&fakeReconcileStore{}, time.Hour)
+
+	stopped := make(chan struct{})
+	go func() {
+		r.Run()
+		close(stopped)
+	}()
+
+	r.Stop()
+	r.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reconciler did not stop")
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+type RewardStorager interface {
+	GetRewardOrder(ctx context.Context, orderNumber string) (*models.RewardOrder, error)
+	GetRewardRules(ctx context.Context) (*[](*models.RewardRule), error)
+}
+
+// RewardEngine is an in-process Accrualer that computes accruals from reward
+// rules instead of calling an external accrual system.
+type RewardEngine struct {
+	storage RewardStorager
+}
+
+func NewRewardEngine(storage RewardStorager) *RewardEngine {
+	return &RewardEngine{storage: storage}
+}
+
+func (e *RewardEngine) CalcOrderAccrual(ctx context.Context, orderNumber string) *AccrualResult {
+	order, err := e.storage.GetRewardOrder(ctx, orderNumber)
+	if err != nil {
+		return transient(err)
+	}
+	if order == nil {
+		return &AccrualResult{Outcome: AccrualUnknown}
+	}
+
+	rules, err := e.storage.GetRewardRules(ctx)
+	if err != nil {
+		return transient(err)
+	}
+
+	// retrying can't make an order with an absurd total any smaller
+	accrual, err := CalcReward(order.Goods, *rules)
+	if err != nil {
+		return &AccrualResult{
+			Outcome:  AccrualFinal,
+			Response: &CalcOrderAccrualResponse{Order: orderNumber, Status: models.INVALID},
+		}
+	}
+
+	return &AccrualResult{
+		Outcome: AccrualFinal,
+		Response: &CalcOrderAccrualResponse{
+			Order:   orderNumber,
+			Accrual: accrual,
+			Status:  models.PROCESSED,
+		},
+	}
+}
+
+// CalcReward sums the rewards of all goods. Each good is rewarded by the
+// first rule whose match is a case-insensitive substring of its description.
+// Percent rewards are summed exactly and the total is rounded half up to
+// hundredths once. A total that doesn't fit Money is reported as
+// models.ErrMoneyFormat.
+func CalcReward(goods []models.Good, rules []*models.RewardRule) (models.Money, error) {
+	// in hundredths of a percent of a hundredth, the unit of price * percent
+	scale := big.NewInt(models.MoneyScale * models.MoneyScale)
+	total := new(big.Int)
+
+	for _, good := range goods {
+		description := strings.ToLower(good.Description)
+
+		for _, rule := range rules {
+			if !strings.Contains(description, strings.ToLower(rule.Match)) {
+				continue
+			}
+
+			reward := big.NewInt(int64(rule.Reward))
+			switch rule.RewardType {
+			case models.RewardPercent:
+				total.Add(total, reward.Mul(reward, big.NewInt(int64(good.Price))))
+			case models.RewardPoints:
+				total.Add(total, reward.Mul(reward, scale))
+			}
+			break
+		}
+	}
+
+	total.Add(total, new(big.Int).Quo(scale, big.NewInt(2)))
+	total.Quo(total, scale)
+
+	if !total.IsInt64() {
+		return 0, models.ErrMoneyFormat
+	}
+
+	return models.Money(total.Int64()), nil
+}
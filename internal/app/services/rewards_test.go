@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestCalcReward(t *testing.T) {
+	rules := []*models.RewardRule{
+		{ID: 1, Match: "Bork", Reward: models.MustParseMoney("10"), RewardType: models.RewardPercent},
+		{ID: 2, Match: "bork kettle", Reward: models.MustParseMoney("100"), RewardType: models.RewardPoints},
+		{ID: 3, Match: "kettle", Reward: models.MustParseMoney("15"), RewardType: models.RewardPoints},
+		{ID: 4, Match: "fraction", Reward: models.MustParseMoney("10"), RewardType: models.RewardPercent},
+		{ID: 5, Match: "lamp", Reward: models.MustParseMoney("15"), RewardType: models.RewardPercent},
+		{ID: 6, Match: "mug", Reward: models.MustParseMoney("50"), RewardType: models.RewardPercent},
+		{ID: 7, Match: "spoon", Reward: models.MustParseMoney("2.5"), RewardType: models.RewardPercent},
+	}
+
+	tests := []struct {
+		name     string
+		goods    []models.Good
+		expected models.Money
+	}{
+		{
+			name:     "No goods",
+			expected: 0,
+		},
+		{
+			name:     "Percent of the price",
+			goods:    []models.Good{{Description: "Bork toaster", Price: models.MustParseMoney("1000")}},
+			expected: models.MustParseMoney("100"),
+		},
+		{
+			name:     "Fixed points",
+			goods:    []models.Good{{Description: "Kettle", Price: models.MustParseMoney("1000")}},
+			expected: models.MustParseMoney("15"),
+		},
+		{
+			name:     "First matching rule wins",
+			goods:    []models.Good{{Description: "Bork Kettle K700", Price: models.MustParseMoney("500")}},
+			expected: models.MustParseMoney("50"),
+		},
+		{
+			name:     "Matching ignores case",
+			goods:    []models.Good{{Description: "BORK BLENDER", Price: models.MustParseMoney("200")}},
+			expected: models.MustParseMoney("20"),
+		},
+		{
+			name:     "Goods without a rule get nothing",
+			goods:    []models.Good{{Description: "Chair", Price: models.MustParseMoney("300")}},
+			expected: 0,
+		},
+		{
+			name: "Rewards of all goods are summed",
+			goods: []models.Good{
+				{Description: "Bork toaster", Price: models.MustParseMoney("1000")},
+				{Description: "Kettle", Price: models.MustParseMoney("10")},
+				{Description: "Chair", Price: models.MustParseMoney("300")},
+			},
+			expected: models.MustParseMoney("115"),
+		},
+		{
+			name:     "Percent is rounded to hundredths",
+			goods:    []models.Good{{Description: "Desk lamp", Price: models.MustParseMoney("9.99")}},
+			expected: models.MustParseMoney("1.5"),
+		},
+		{
+			name:     "Half a hundredth is rounded up",
+			goods:    []models.Good{{Description: "Mug", Price: models.MustParseMoney("1.15")}},
+			expected: models.MustParseMoney("0.58"),
+		},
+		{
+			name:     "Fractional percent",
+			goods:    []models.Good{{Description: "Spoon", Price: models.MustParseMoney("10.1")}},
+			expected: models.MustParseMoney("0.25"),
+		},
+		{
+			name: "The sum is rounded, not every reward",
+			goods: []models.Good{
+				{Description: "Fraction one", Price: models.MustParseMoney("0.05")},
+				{Description: "Fraction two", Price: models.MustParseMoney("0.05")},
+			},
+			expected: models.MustParseMoney("0.01"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reward, err := CalcReward(tt.goods, rules)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, reward)
+		})
+	}
+}
+
+func TestCalcRewardOverflow(t *testing.T) {
+	rules := []*models.RewardRule{{Match: "gold", Reward: models.MustParseMoney("999999999999999"), RewardType: models.RewardPoints}}
+	goods := make([]models.Good, 100)
+	for i := range goods {
+		goods[i] = models.Good{Description: "Gold bar"}
+	}
+
+	_, err := CalcReward(goods, rules)
+	assert.ErrorIs(t, err, models.ErrMoneyFormat)
+}
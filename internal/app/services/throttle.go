@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = time.Minute
+
+var rateLimitRe = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// AccrualThrottle is shared by every AccrualService in the process, so a 429
+// seen by one worker pauses all outgoing accrual calls.
+var AccrualThrottle = NewThrottle()
+
+type Throttle struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+	interval    time.Duration
+	next        time.Time
+	// free holds slots given back by cancelled waiters, earliest first.
+	free []time.Time
+	// epoch changes whenever the pause is extended, voiding the slots
+	// reserved before it.
+	epoch uint64
+}
+
+// reservation is the moment a waiter may send its request at. Only
+// reservations taken while a rate was set hold a slot.
+type reservation struct {
+	at      time.Time
+	epoch   uint64
+	slotted bool
+}
+
+func NewThrottle() *Throttle {
+	return &Throttle{}
+}
+
+// Wait blocks until the caller is allowed to send the next request. Every
+// call takes exactly one slot and gives it back if ctx is done first.
+func (t *Throttle) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		r := t.reserve()
+		t.mu.Unlock()
+
+		if delay := time.Until(r.at); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				t.release(r)
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		t.mu.Lock()
+		valid := r.epoch == t.epoch
+		t.mu.Unlock()
+
+		// the pause was extended while we waited, so reserve again after it
+		if valid {
+			return nil
+		}
+	}
+}
+
+// reserve must be called with t.mu held.
+func (t *Throttle) reserve() reservation {
+	at := time.Now()
+	if t.pausedUntil.After(at) {
+		at = t.pausedUntil
+	}
+
+	if t.interval <= 0 {
+		return reservation{at: at, epoch: t.epoch}
+	}
+
+	// a slot in the past would land right next to its neighbours
+	for len(t.free) > 0 && t.free[0].Before(at) {
+		t.free = t.free[1:]
+	}
+
+	if len(t.free) > 0 {
+		slot := t.free[0]
+		t.free = t.free[1:]
+
+		return reservation{at: slot, epoch: t.epoch, slotted: true}
+	}
+
+	if t.next.After(at) {
+		at = t.next
+	}
+	t.next = at.Add(t.interval)
+
+	return reservation{at: at, epoch: t.epoch, slotted: true}
+}
+
+func (t *Throttle) release(r reservation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !r.slotted || r.epoch != t.epoch {
+		return
+	}
+
+	if r.at.Add(t.interval).Equal(t.next) {
+		t.next = r.at
+		for n := len(t.free); n > 0 && t.free[n-1].Add(t.interval).Equal(t.next); n-- {
+			t.next = t.free[n-1]
+			t.free = t.free[:n-1]
+		}
+
+		return
+	}
+
+	i := sort.Search(len(t.free), func(i int) bool { return t.free[i].After(r.at) })
+	t.free = append(t.free, time.Time{})
+	copy(t.free[i+1:], t.free[i:])
+	t.free[i] = r.at
+}
+
+// Pause holds every request for d. Extending an active pause voids the
+// reserved slots: their waiters reserve again, spaced after the pause.
+func (t *Throttle) Pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(t.pausedUntil) {
+		t.pausedUntil = until
+		t.next = until
+		t.free = nil
+		t.epoch++
+	}
+}
+
+func (t *Throttle) SetRate(perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.interval = time.Minute / time.Duration(perMinute)
+}
+
+// Delay is how long a call to Wait made now would block, without reserving
+// anything.
+func (t *Throttle) Delay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	at := now
+	if t.pausedUntil.After(at) {
+		at = t.pausedUntil
+	}
+
+	if t.interval > 0 {
+		free := -1
+		for i, slot := range t.free {
+			if !slot.Before(at) {
+				free = i
+				break
+			}
+		}
+
+		switch {
+		case free >= 0:
+			at = t.free[free]
+		case t.next.After(at):
+			at = t.next
+		}
+	}
+
+	return at.Sub(now)
+}
+
+func (t *Throttle) PausedUntil() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.pausedUntil
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	return defaultRetryAfter
+}
+
+func parseRateLimit(body string) int {
+	m := rateLimitRe.FindStringSubmatch(body)
+	if m == nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottlePause(t *testing.T) {
+	th := NewThrottle()
+	th.Pause(50 * time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(t, th.Wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	start = time.Now()
+	assert.NoError(t, th.Wait(context.Background()))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestThrottlePauseExtended(t *testing.T) {
+	th := NewThrottle()
+	th.SetRate(300) // a slot every 200ms
+	th.Pause(50 * time.Millisecond)
+
+	start := time.Now()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		th.Pause(80 * time.Millisecond)
+	}()
+
+	assert.NoError(t, th.Wait(context.Background()))
+	first := time.Since(start)
+	assert.GreaterOrEqual(t, first, 100*time.Millisecond)
+	assert.Less(t, first, 200*time.Millisecond, "the waiter took a second slot")
+
+	assert.NoError(t, th.Wait(context.Background()))
+	second := time.Since(start)
+	assert.GreaterOrEqual(t, second, 300*time.Millisecond)
+	assert.Less(t, second, 400*time.Millisecond)
+}
+
+func TestThrottleRate(t *testing.T) {
+	th := NewThrottle()
+	th.SetRate(600) // a slot every 100ms
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, th.Wait(context.Background()))
+	}
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond)
+	assert.Less(t, elapsed, 300*time.Millisecond)
+}
+
+func TestThrottleCancelReleasesSlot(t *testing.T) {
+	t.Run("Last slot", func(t *testing.T) {
+		th := NewThrottle()
+		th.SetRate(600)
+		assert.NoError(t, th.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, th.Wait(ctx), context.DeadlineExceeded)
+
+		// the cancelled slot at 100ms is free again, the next one is at 200ms
+		ctx, cancel = context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, th.Wait(ctx))
+	})
+
+	t.Run("Slot in the middle", func(t *testing.T) {
+		th := NewThrottle()
+		th.SetRate(600)
+		assert.NoError(t, th.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		done := make(chan error)
+		go func() { done <- th.Wait(ctx) }()
+		time.Sleep(5 * time.Millisecond)
+
+		later := make(chan time.Duration)
+		start := time.Now()
+		go func() {
+			_ = th.Wait(context.Background())
+			later <- time.Since(start)
+		}()
+
+		assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, th.Wait(ctx))
+
+		// the waiter behind the cancelled one keeps its own slot
+		assert.GreaterOrEqual(t, <-later, 190*time.Millisecond)
+	})
+}
+
+func TestThrottleDelay(t *testing.T) {
+	th := NewThrottle()
+	assert.Equal(t, time.Duration(0), th.Delay())
+
+	th.SetRate(600)
+	assert.NoError(t, th.Wait(context.Background()))
+	assert.InDelta(t, float64(100*time.Millisecond), float64(th.Delay()), float64(10*time.Millisecond))
+
+	th.Pause(time.Second)
+	assert.InDelta(t, float64(time.Second), float64(th.Delay()), float64(10*time.Millisecond))
+}
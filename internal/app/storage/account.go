@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// ChangeUserPassword stores the new hash and revokes every session of the
+// user except keepSessionID.
+func (s *Storage) ChangeUserPassword(ctx context.Context, userID uint, password, keepSessionID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2 AND deleted_at IS NULL`, password, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND session_id <> $2 AND revoked_at IS NULL
+	`, userID, keepSessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) GetAccount(ctx context.Context, userID uint) (*models.Account, error) {
+	var account models.Account
+	var registeredAt time.Time
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			u.login,
+			u.created_at,
+			(SELECT count(*) FROM orders o WHERE o.user_id = u.id),
+			(SELECT count(*) FROM withdrawals w WHERE w.user_id = u.id)
+		FROM
+			users u
+		WHERE
+			u.id = $1
+			AND u.deleted_at IS NULL
+	`, userID).Scan(&account.Login, &registeredAt, &account.OrdersCount, &account.WithdrawalsCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	account.RegisteredAt = helpers.RFC3339Time(registeredAt)
+
+	return &account, nil
+}
+
+// DeleteUser closes the account without erasing its history. Orders and
+// withdrawals are kept for accounting, so their numbers can't be reused, while
+// the user row is anonymized: the login is replaced with one that can't be
+// registered, the password can't match anything and the remaining balance is
+// forfeited. Orders still waiting for an accrual are marked INVALID and every
+// session is revoked.
+func (s *Storage) DeleteUser(ctx context.Context, userID uint) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	user, err := s.GetUserByID(tx, userID, true)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET login = '#deleted-' || id, password = '', balance = 0, deleted_at = now() WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Balance != 0 {
+		err = s.postLedger(ctx, tx, models.LedgerForfeiture, accountForfeitures, "", userID, -user.Balance)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE accrual_jobs SET completed_at = now(), locked_until = NULL
+		WHERE completed_at IS NULL AND order_id IN (SELECT id FROM orders WHERE user_id = $1)
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders SET status = $2 WHERE user_id = $1 AND status NOT IN ($2, $3)
+	`, userID, models.INVALID, models.PROCESSED)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
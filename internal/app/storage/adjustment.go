@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+// AdjustBalance applies an operator's credit or debit. The user row is locked
+// the same way WithdrawBalance locks it, and a debit can't take the balance
+// below zero.
+func (s *Storage) AdjustBalance(ctx context.Context, adj *models.BalanceAdjustment) (*models.BalanceAdjustment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	user, err := s.GetUserByID(tx, adj.UserID, true)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	logger.Infof(
+		"AdjustBalance with: userID: %d, operatorID: %d, amount: %s, reason: %s, userBalance: %s",
+		adj.UserID, adj.OperatorID, adj.Amount, adj.Reason, user.Balance)
+
+	if user.Balance+adj.Amount < 0 {
+		return nil, ErrInsufficientBalance
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET balance = balance + $1 WHERE id = $2", adj.Amount, adj.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	created := *adj
+	var createdAt time.Time
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO balance_adjustments (user_id, operator_id, amount, reason, comment)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, adj.UserID, adj.OperatorID, adj.Amount, adj.Reason, adj.Comment).Scan(&created.ID, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := models.LedgerAdjustment
+	if adj.Reason == models.AdjustmentFraudReversal {
+		kind = models.LedgerReversal
+	}
+
+	err = s.postLedger(ctx, tx, kind, accountAdjustments, fmt.Sprintf("adjustment:%d", created.ID), adj.UserID, adj.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	created.CreatedAt = helpers.RFC3339Time(createdAt)
+
+	return &created, nil
+}
+
+func (s *Storage) GetBalanceAdjustments(ctx context.Context, filter models.AdjustmentFilter) (*[](*models.BalanceAdjustment), error) {
+	adjustments := make([]*models.BalanceAdjustment, 0)
+	w := adjustmentWhere(filter)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			user_id,
+			operator_id,
+			amount,
+			reason,
+			comment,
+			created_at
+		FROM
+			balance_adjustments
+		`+w.String()+`
+		`+orderBy("created_at", filter.Desc)+`
+		`+limit(filter.Limit), w.args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var adj models.BalanceAdjustment
+		var createdAt time.Time
+		if err := rows.Scan(
+			&adj.ID,
+			&adj.UserID,
+			&adj.OperatorID,
+			&adj.Amount,
+			&adj.Reason,
+			&adj.Comment,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		adj.CreatedAt = helpers.RFC3339Time(createdAt)
+		adjustments = append(adjustments, &adj)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &adjustments, nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers finds users whose login contains query, deleted ones included.
+func (s *Storage) SearchUsers(ctx context.Context, query string, limit int) (*[](*models.UserSummary), error) {
+	users := make([]*models.UserSummary, 0)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			login,
+			balance,
+			withdrawn,
+			roles,
+			created_at,
+			deleted_at IS NOT NULL
+		FROM
+			users
+		WHERE
+			login ILIKE '%' || $1 || '%'
+		ORDER BY
+			login ASC
+		LIMIT $2
+	`, likeEscaper.Replace(query), limit)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.UserSummary
+		var registeredAt time.Time
+		if err := rows.Scan(
+			&user.ID,
+			&user.Login,
+			&user.Balance,
+			&user.Withdrawn,
+			pq.Array(&user.Roles),
+			&registeredAt,
+			&user.Deleted,
+		); err != nil {
+			return nil, err
+		}
+		user.RegisteredAt = helpers.RFC3339Time(registeredAt)
+		users = append(users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &users, nil
+}
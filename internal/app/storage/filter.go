@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+// where collects filter conditions. Every argument of a condition is
+// referenced as %s in cond, in order.
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *where) add(cond string, args ...interface{}) {
+	refs := make([]interface{}, len(args))
+	for i, arg := range args {
+		w.args = append(w.args, arg)
+		refs[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.conds = append(w.conds, fmt.Sprintf(cond, refs...))
+}
+
+// after continues a listing sorted by column and id past pos.
+func (w *where) after(column string, pos *models.ListPosition, desc bool) {
+	if pos == nil {
+		return
+	}
+
+	op := ">"
+	if desc {
+		op = "<"
+	}
+
+	w.add("("+column+", id) "+op+" (%s, %s)", pos.Time, pos.ID)
+}
+
+// orderBy sorts by column with id as the tie breaker, so keyset pagination
+// never skips or repeats rows with the same time.
+func orderBy(column string, desc bool) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	return "ORDER BY " + column + " " + dir + ", id " + dir
+}
+
+func limit(n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("LIMIT %d", n)
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+
+	return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func orderWhere(f models.OrderFilter) *where {
+	w := &where{}
+
+	if f.UserID > 0 {
+		w.add("user_id = %s", f.UserID)
+	}
+
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			statuses[i] = string(status)
+		}
+		w.add("status = ANY(%s)", pq.Array(statuses))
+	}
+
+	if !f.From.IsZero() {
+		w.add("uploaded_at >= %s", f.From)
+	}
+
+	if !f.To.IsZero() {
+		w.add("uploaded_at < %s", f.To)
+	}
+
+	w.after("uploaded_at", f.After, f.Desc)
+
+	return w
+}
+
+func withdrawalWhere(f models.WithdrawalFilter) *where {
+	w := &where{}
+
+	if f.UserID > 0 {
+		w.add("user_id = %s", f.UserID)
+	}
+
+	if !f.From.IsZero() {
+		w.add("processed_at >= %s", f.From)
+	}
+
+	if !f.To.IsZero() {
+		w.add("processed_at < %s", f.To)
+	}
+
+	w.after("processed_at", f.After, f.Desc)
+
+	return w
+}
+
+func adjustmentWhere(f models.AdjustmentFilter) *where {
+	w := &where{}
+
+	if f.UserID > 0 {
+		w.add("user_id = %s", f.UserID)
+	}
+
+	if !f.From.IsZero() {
+		w.add("created_at >= %s", f.From)
+	}
+
+	if !f.To.IsZero() {
+		w.add("created_at < %s", f.To)
+	}
+
+	w.after("created_at", f.After, f.Desc)
+
+	return w
+}
+
+func balanceHistoryWhere(f models.BalanceHistoryFilter) *where {
+	w := &where{}
+
+	w.add("user_id = %s", f.UserID)
+
+	if f.AfterID > 0 {
+		w.add("id > %s", f.AfterID)
+	}
+
+	if !f.From.IsZero() {
+		w.add("created_at >= %s", f.From)
+	}
+
+	if !f.To.IsZero() {
+		w.add("created_at < %s", f.To)
+	}
+
+	return w
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+// ClaimAccrualJobs leases up to limit due jobs to the caller. Rows locked by
+// other instances are skipped, and a leased job becomes claimable again once
+// the lease expires, so a crashed worker never loses a job.
+func (s *Storage) ClaimAccrualJobs(ctx context.Context, limit int, lease time.Duration) (*[](*models.AccrualJob), error) {
+	jobs := make([]*models.AccrualJob, 0)
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH claimed AS (
+			SELECT
+				id
+			FROM
+				accrual_jobs
+			WHERE
+				completed_at IS NULL
+				AND next_run_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY
+				next_run_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE
+			accrual_jobs j
+		SET
+			locked_until = now() + $2 * INTERVAL '1 millisecond',
+			attempts = j.attempts + 1
+		FROM
+			claimed,
+			orders o
+		WHERE
+			j.id = claimed.id
+			AND o.id = j.order_id
+		RETURNING
+			j.id,
+			j.attempts,
+			j.last_error,
+			o.id,
+			o.user_id,
+			o.number,
+			o.status,
+			o.accrual,
+			o.uploaded_at
+	`, limit, lease.Milliseconds())
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var job models.AccrualJob
+		if err := rows.Scan(
+			&job.ID,
+			&job.Attempts,
+			&job.LastError,
+			&job.Order.ID,
+			&job.Order.UserID,
+			&job.Order.Number,
+			&job.Order.Status,
+			&job.Order.Accrual,
+			&job.Order.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &jobs, nil
+}
+
+func (s *Storage) CompleteAccrualJob(ctx context.Context, jobID uint) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE
+			accrual_jobs
+		SET
+			completed_at = now(),
+			locked_until = NULL,
+			last_error = NULL
+		WHERE
+			id = $1
+	`, jobID)
+
+	return err
+}
+
+func (s *Storage) RescheduleAccrualJob(ctx context.Context, jobID uint, delay time.Duration, lastError string) error {
+	var lastErr *string
+	if len(lastError) > 0 {
+		lastErr = &lastError
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE
+			accrual_jobs
+		SET
+			next_run_at = now() + $2 * INTERVAL '1 millisecond',
+			locked_until = NULL,
+			last_error = $3
+		WHERE
+			id = $1
+	`, jobID, delay.Milliseconds(), lastErr)
+
+	return err
+}
+
+// RecoverAccrualJobs makes sure up to limit orders in a non-final status have
+// an open job, reopening completed ones if needed. It returns how many jobs
+// were created or reopened.
+func (s *Storage) RecoverAccrualJobs(ctx context.Context, limit int) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO accrual_jobs (order_id)
+		SELECT
+			o.id
+		FROM
+			orders o
+		WHERE
+			o.status IN ($1, $2)
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					accrual_jobs j
+				WHERE
+					j.order_id = o.id
+					AND j.completed_at IS NULL
+			)
+		ORDER BY
+			o.uploaded_at ASC
+		LIMIT $3
+		ON CONFLICT (order_id) DO UPDATE
+		SET
+			completed_at = NULL,
+			locked_until = NULL,
+			next_run_at = now(),
+			attempts = 0
+	`, models.NEW, models.PROCESSING, limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (s *Storage) RecordAccrualAttempt(ctx context.Context, attempt *models.AccrualAttempt) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO accrual_attempts (order_id, outcome, status, accrual, error) VALUES ($1, $2, $3, $4, $5)
+	`, attempt.OrderID, attempt.Outcome, attempt.Status, attempt.Accrual, attempt.Error)
+
+	return err
+}
+
+// GetAccrualHistory returns nil when there is no order with this number.
+func (s *Storage) GetAccrualHistory(ctx context.Context, orderNumber string) (*models.AccrualHistory, error) {
+	order, err := s.GetOrderByNumber(nil, orderNumber)
+	if err != nil || order == nil {
+		return nil, err
+	}
+
+	history := &models.AccrualHistory{Order: *order, Attempts: make([]*models.AccrualAttempt, 0)}
+
+	var job models.AccrualJobState
+	var nextRunAt time.Time
+	var completedAt sql.NullTime
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT attempts, next_run_at, completed_at, last_error FROM accrual_jobs WHERE order_id = $1
+	`, order.ID).Scan(&job.Attempts, &nextRunAt, &completedAt, &job.LastError)
+
+	switch err {
+	case nil:
+		job.NextRunAt = helpers.RFC3339Time(nextRunAt)
+		if completedAt.Valid {
+			t := helpers.RFC3339Time(completedAt.Time)
+			job.CompletedAt = &t
+		}
+		history.Job = &job
+	case sql.ErrNoRows:
+	default:
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			outcome,
+			status,
+			accrual,
+			error,
+			created_at
+		FROM
+			accrual_attempts
+		WHERE
+			order_id = $1
+		ORDER BY
+			created_at ASC, id ASC
+	`, order.ID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attempt := models.AccrualAttempt{OrderID: order.ID}
+		var createdAt time.Time
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.Outcome,
+			&attempt.Status,
+			&attempt.Accrual,
+			&attempt.Error,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		attempt.CreatedAt = helpers.RFC3339Time(createdAt)
+		history.Attempts = append(history.Attempts, &attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestStorage_RecoverAccrualJobs(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	user, err := s.CreateUser(ctx, "gopher", "hash")
+	assert.NoError(t, err)
+
+	// every order is created with an open job, take it away or complete it
+	// to get the states a crash or an old release could leave behind
+	withoutJob := createTestOrder(t, s, user.ID, "12345678903", models.NEW)
+	_, err = s.db.Exec("DELETE FROM accrual_jobs WHERE order_id = $1", withoutJob.ID)
+	assert.NoError(t, err)
+
+	completed := createTestOrder(t, s, user.ID, "9278923470", models.PROCESSING)
+	_, err = s.db.Exec("UPDATE accrual_jobs SET completed_at = now() WHERE order_id = $1", completed.ID)
+	assert.NoError(t, err)
+
+	open := createTestOrder(t, s, user.ID, "346436439", models.PROCESSING)
+
+	processed := createTestOrder(t, s, user.ID, "2377225624", models.PROCESSED)
+	invalid := createTestOrder(t, s, user.ID, "2377225632", models.INVALID)
+	_, err = s.db.Exec("UPDATE accrual_jobs SET completed_at = now() WHERE order_id IN ($1, $2)", processed.ID, invalid.ID)
+	assert.NoError(t, err)
+
+	n, err := s.RecoverAccrualJobs(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = s.RecoverAccrualJobs(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = s.RecoverAccrualJobs(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	for _, tt := range []struct {
+		order   *models.Order
+		pending bool
+	}{
+		{order: withoutJob, pending: true},
+		{order: completed, pending: true},
+		{order: open, pending: true},
+		{order: processed, pending: false},
+		{order: invalid, pending: false},
+	} {
+		var pending bool
+		err := s.db.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM accrual_jobs WHERE order_id = $1 AND completed_at IS NULL)",
+			tt.order.ID,
+		).Scan(&pending)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.pending, pending, "order %s", tt.order.Number)
+	}
+}
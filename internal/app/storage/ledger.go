@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+// System accounts are the other side of user entries: points come from
+// accruals and adjustments and go to withdrawals and forfeitures.
+const (
+	accountAccruals    = "system:accruals"
+	accountWithdrawals = "system:withdrawals"
+	accountAdjustments = "system:adjustments"
+	accountForfeitures = "system:forfeitures"
+)
+
+func userAccount(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// postLedger records a transaction moving amount into the user's account
+// from the system account, or out of it when amount is negative. It must run
+// in the same transaction as the balance update it accounts for.
+func (s *Storage) postLedger(ctx context.Context, tx *sql.Tx, kind models.LedgerKind, system, ref string, userID uint, amount models.Money) error {
+	_, err := tx.ExecContext(ctx, `
+		WITH txn AS (
+			SELECT nextval('ledger_txn_seq') AS id
+		)
+		INSERT INTO ledger_entries (txn_id, account, user_id, kind, ref, amount)
+		SELECT id, $1::varchar, $2::int, $3::varchar, NULLIF($4::varchar, ''), $5::numeric FROM txn
+		UNION ALL
+		SELECT id, $6::varchar, NULL, $3::varchar, NULLIF($4::varchar, ''), -$5::numeric FROM txn
+	`, userAccount(userID), userID, kind, ref, amount, system)
+
+	return err
+}
+
+// ReconcileBalances compares the cached balance and withdrawn total of every
+// user with the sums of their ledger entries and returns the users that
+// drifted apart.
+func (s *Storage) ReconcileBalances(ctx context.Context) (*[](*models.BalanceDrift), error) {
+	drifts := make([]*models.BalanceDrift, 0)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			u.id,
+			u.login,
+			u.balance,
+			COALESCE(l.balance, 0),
+			u.withdrawn,
+			COALESCE(l.withdrawn, 0)
+		FROM
+			users u
+			LEFT JOIN (
+				SELECT
+					user_id,
+					SUM(amount) AS balance,
+					-SUM(amount) FILTER (WHERE kind = $1) AS withdrawn
+				FROM
+					ledger_entries
+				WHERE
+					user_id IS NOT NULL
+				GROUP BY
+					user_id
+			) l ON l.user_id = u.id
+		WHERE
+			u.balance <> COALESCE(l.balance, 0)
+			OR u.withdrawn <> COALESCE(l.withdrawn, 0)
+		ORDER BY
+			u.id ASC
+	`, models.LedgerWithdrawal)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drift models.BalanceDrift
+		if err := rows.Scan(
+			&drift.UserID,
+			&drift.Login,
+			&drift.Balance,
+			&drift.LedgerBalance,
+			&drift.Withdrawn,
+			&drift.LedgerWithdrawn,
+		); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, &drift)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &drifts, nil
+}
+
+// GetBalanceHistory returns the user's ledger entries with the running
+// balance after each of them. The balance is summed over the whole history,
+// so filtering by date or cursor doesn't change it; the user_id condition is
+// on the partition column and gets pushed into the window query.
+func (s *Storage) GetBalanceHistory(ctx context.Context, filter models.BalanceHistoryFilter) (*[](*models.BalanceEvent), error) {
+	events := make([]*models.BalanceEvent, 0)
+	w := balanceHistoryWhere(filter)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			kind,
+			ref,
+			amount,
+			balance,
+			created_at
+		FROM
+			(
+				SELECT
+					id,
+					user_id,
+					kind,
+					ref,
+					amount,
+					SUM(amount) OVER (PARTITION BY user_id ORDER BY id) AS balance,
+					created_at
+				FROM
+					ledger_entries
+				WHERE
+					user_id IS NOT NULL
+			) h
+		`+w.String()+`
+		ORDER BY
+			id ASC
+		`+limit(filter.Limit), w.args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.BalanceEvent
+		var createdAt time.Time
+		if err := rows.Scan(
+			&event.ID,
+			&event.Kind,
+			&event.Ref,
+			&event.Amount,
+			&event.Balance,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		event.CreatedAt = helpers.RFC3339Time(createdAt)
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &events, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (s *Storage) LoginLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until sql.NullTime
+
+	err := s.db.QueryRowContext(ctx, `SELECT locked_until FROM login_attempts WHERE key = $1`, key).Scan(&until)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+
+	return until.Time, nil
+}
+
+// AddLoginFailure also drops the counters that are neither locked nor inside
+// the window, successful logins only clean up after themselves.
+func (s *Storage) AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < now() - make_interval(secs => $1)
+			AND (locked_until IS NULL OR locked_until < now())
+	`, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	var failures int
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < now() - make_interval(secs => $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = now()
+		RETURNING failures
+	`, key, window.Seconds()).Scan(&failures)
+
+	return failures, err
+}
+
+func (s *Storage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE login_attempts SET locked_until = GREATEST(COALESCE(locked_until, $2), $2) WHERE key = $1
+	`, key, until)
+
+	return err
+}
+
+func (s *Storage) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+func (s *Storage) RecordLoginLockout(ctx context.Context, kind, subject string, failures int, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO login_lockouts (kind, subject, failures, locked_until) VALUES ($1, $2, $3, $4)
+	`, kind, subject, failures, until)
+
+	return err
+}
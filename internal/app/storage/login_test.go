@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorage_AddLoginFailureDropsExpired(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	_, err := s.db.Exec(`
+		INSERT INTO login_attempts (key, failures, last_failure_at, locked_until) VALUES
+			('login:expired', 3, now() - interval '1 hour', NULL),
+			('login:lock-expired', 10, now() - interval '1 hour', now() - interval '1 minute'),
+			('login:locked', 10, now() - interval '1 hour', now() + interval '1 hour'),
+			('login:recent', 2, now() - interval '1 minute', NULL)
+	`)
+	assert.NoError(t, err)
+
+	failures, err := s.AddLoginFailure(ctx, "login:recent", time.Minute*15)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failures)
+
+	failures, err = s.AddLoginFailure(ctx, "login:expired", time.Minute*15)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failures, "an expired counter starts over")
+
+	rows, err := s.db.Query("SELECT key FROM login_attempts ORDER BY key")
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		assert.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.NoError(t, rows.Err())
+
+	assert.Equal(t, []string{"login:expired", "login:locked", "login:recent"}, keys)
+}
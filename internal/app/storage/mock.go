@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -15,7 +16,8 @@ type MockStorager struct {
 }
 
 func (m *MockStorager) UpdateOrderStatus(ctx context.Context, orderID uint, status models.OrderStatus) error {
-	return nil
+	args := m.Called(ctx, orderID, status)
+	return args.Error(0)
 }
 
 func (m *MockStorager) Close() error {
@@ -38,6 +40,46 @@ func (m *MockStorager) CreateUser(ctx context.Context, login, password string) (
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockStorager) UpdateUserPassword(ctx context.Context, userID uint, password string) error {
+	args := m.Called(ctx, userID, password)
+	return args.Error(0)
+}
+
+func (m *MockStorager) ChangeUserPassword(ctx context.Context, userID uint, password, keepSessionID string) error {
+	args := m.Called(ctx, userID, password, keepSessionID)
+	return args.Error(0)
+}
+
+func (m *MockStorager) GetAccount(ctx context.Context, userID uint) (*models.Account, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(*models.Account), args.Error(1)
+}
+
+func (m *MockStorager) DeleteUser(ctx context.Context, userID uint) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStorager) SetUserRoles(ctx context.Context, userID uint, roles []string) error {
+	args := m.Called(ctx, userID, roles)
+	return args.Error(0)
+}
+
+func (m *MockStorager) CreateRefreshToken(ctx context.Context, userID uint, sessionID, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, sessionID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStorager) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	args := m.Called(ctx, oldHash, newHash, expiresAt)
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockStorager) RevokeSession(ctx context.Context, sessionID string) error {
+	args := m.Called(ctx, sessionID)
+	return args.Error(0)
+}
+
 func (m *MockStorager) GetOrderByNumber(tx *sql.Tx, orderNumber string) (*models.Order, error) {
 	args := m.Called(tx, orderNumber)
 	return args.Get(0).(*models.Order), args.Error(1)
@@ -58,7 +100,7 @@ func (m *MockStorager) GetOrdersByUserID(userID uint) (*[](*models.Order), error
 	return args.Get(0).(*[](*models.Order)), args.Error(1)
 }
 
-func (m *MockStorager) WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount float64) error {
+func (m *MockStorager) WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount models.Money) error {
 	args := m.Called(ctx, userID, orderNumber, withdrawalAmount)
 	return args.Error(0)
 }
@@ -67,3 +109,98 @@ func (m *MockStorager) GetUserWithdrawals(userID uint) (*[](*models.Withdrawal),
 	args := m.Called(userID)
 	return args.Get(0).(*[](*models.Withdrawal)), args.Error(1)
 }
+
+func (m *MockStorager) ClaimAccrualJobs(ctx context.Context, limit int, lease time.Duration) (*[](*models.AccrualJob), error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).(*[](*models.AccrualJob)), args.Error(1)
+}
+
+func (m *MockStorager) CompleteAccrualJob(ctx context.Context, jobID uint) error {
+	args := m.Called(ctx, jobID)
+	return args.Error(0)
+}
+
+func (m *MockStorager) RescheduleAccrualJob(ctx context.Context, jobID uint, delay time.Duration, lastError string) error {
+	args := m.Called(ctx, jobID, delay, lastError)
+	return args.Error(0)
+}
+
+func (m *MockStorager) RecoverAccrualJobs(ctx context.Context, limit int) (int, error) {
+	args := m.Called(ctx, limit)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorager) CreateRewardRule(ctx context.Context, rule *models.RewardRule) (*models.RewardRule, error) {
+	args := m.Called(ctx, rule)
+	return args.Get(0).(*models.RewardRule), args.Error(1)
+}
+
+func (m *MockStorager) GetRewardRules(ctx context.Context) (*[](*models.RewardRule), error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*[](*models.RewardRule)), args.Error(1)
+}
+
+func (m *MockStorager) DeleteRewardRule(ctx context.Context, ruleID uint) error {
+	args := m.Called(ctx, ruleID)
+	return args.Error(0)
+}
+
+func (m *MockStorager) CreateRewardOrder(ctx context.Context, order *models.RewardOrder) error {
+	args := m.Called(ctx, order)
+	return args.Error(0)
+}
+
+func (m *MockStorager) GetRewardOrder(ctx context.Context, orderNumber string) (*models.RewardOrder, error) {
+	args := m.Called(ctx, orderNumber)
+	return args.Get(0).(*models.RewardOrder), args.Error(1)
+}
+
+func (m *MockStorager) GetOrders(ctx context.Context, filter models.OrderFilter) (*[](*models.Order), error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*[](*models.Order)), args.Error(1)
+}
+
+func (m *MockStorager) GetWithdrawals(ctx context.Context, filter models.WithdrawalFilter) (*[](*models.Withdrawal), error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*[](*models.Withdrawal)), args.Error(1)
+}
+
+func (m *MockStorager) SearchUsers(ctx context.Context, query string, limit int) (*[](*models.UserSummary), error) {
+	args := m.Called(ctx, query, limit)
+	return args.Get(0).(*[](*models.UserSummary)), args.Error(1)
+}
+
+func (m *MockStorager) RecordAccrualAttempt(ctx context.Context, attempt *models.AccrualAttempt) error {
+	args := m.Called(ctx, attempt)
+	return args.Error(0)
+}
+
+func (m *MockStorager) GetAccrualHistory(ctx context.Context, orderNumber string) (*models.AccrualHistory, error) {
+	args := m.Called(ctx, orderNumber)
+	return args.Get(0).(*models.AccrualHistory), args.Error(1)
+}
+
+func (m *MockStorager) AdjustBalance(ctx context.Context, adj *models.BalanceAdjustment) (*models.BalanceAdjustment, error) {
+	args := m.Called(ctx, adj)
+	return args.Get(0).(*models.BalanceAdjustment), args.Error(1)
+}
+
+func (m *MockStorager) GetBalanceAdjustments(ctx context.Context, filter models.AdjustmentFilter) (*[](*models.BalanceAdjustment), error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*[](*models.BalanceAdjustment)), args.Error(1)
+}
+
+func (m *MockStorager) ReconcileBalances(ctx context.Context) (*[](*models.BalanceDrift), error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*[](*models.BalanceDrift)), args.Error(1)
+}
+
+func (m *MockStorager) GetBalanceHistory(ctx context.Context, filter models.BalanceHistoryFilter) (*[](*models.BalanceEvent), error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*[](*models.BalanceEvent)), args.Error(1)
+}
+
+func (m *MockStorager) IsSessionActive(ctx context.Context, userID uint, sessionID string) (bool, error) {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Bool(0), args.Error(1)
+}
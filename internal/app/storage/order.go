@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
 	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
 	"github.com/vtcaregorodtcev/gophermarket/internal/models"
 )
@@ -14,9 +16,14 @@ var ErrInsufficientBalance = errors.New("insufficient balance")
 var ErrOrderAlreadyExists = errors.New("order already exists")
 
 func (s *Storage) GetOrdersByUserID(userID uint) (*[](*models.Order), error) {
+	return s.GetOrders(context.Background(), models.OrderFilter{UserID: userID})
+}
+
+func (s *Storage) GetOrders(ctx context.Context, filter models.OrderFilter) (*[](*models.Order), error) {
 	orders := make([]*models.Order, 0)
+	w := orderWhere(filter)
 
-	rows, err := s.db.Query(`
+	rows, err := s.db.QueryContext(ctx, `
 		SELECT
 			id,
 			user_id,
@@ -26,11 +33,9 @@ func (s *Storage) GetOrdersByUserID(userID uint) (*[](*models.Order), error) {
 			uploaded_at
 		FROM
 			orders
-		WHERE
-			user_id = $1
-		ORDER BY
-			uploaded_at ASC
-	`, userID)
+		`+w.String()+`
+		`+orderBy("uploaded_at", filter.Desc)+`
+		`+limit(filter.Limit), w.args...)
 
 	if err != nil {
 		return nil, err
@@ -105,23 +110,44 @@ func (s *Storage) CreateOrder(ctx context.Context, orderNumber string, userID ui
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	query := `INSERT INTO orders (number, user_id, status) VALUES ($1, $2, $3) RETURNING id`
+	// the share lock waits for a concurrent DeleteUser, so an order can't
+	// slip in after its sweep of open orders
+	var live bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL FOR SHARE)
+	`, userID).Scan(&live)
+	if err != nil {
+		return nil, err
+	}
+	if !live {
+		return nil, ErrUserNotFound
+	}
+
+	query := `INSERT INTO orders (number, user_id, status) VALUES ($1, $2, $3) RETURNING id, uploaded_at`
 	var id uint
-	err = tx.QueryRowContext(ctx, query, orderNumber, userID, models.NEW).Scan(&id)
+	var uploadedAt helpers.RFC3339Time
+	err = tx.QueryRowContext(ctx, query, orderNumber, userID, models.NEW).Scan(&id, &uploadedAt)
 
 	if err != nil {
 		return nil, err
 	}
 
+	_, err = tx.ExecContext(ctx, `INSERT INTO accrual_jobs (order_id) VALUES ($1)`, id)
+	if err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
 	return &models.Order{
-		ID:     id,
-		Number: orderNumber,
-		Status: models.NEW,
+		ID:         id,
+		UserID:     userID,
+		Number:     orderNumber,
+		Status:     models.NEW,
+		UploadedAt: uploadedAt,
 	}, nil
 }
 
@@ -138,14 +164,16 @@ func (s *Storage) UpdateOrderStatus(ctx context.Context, orderID uint, status mo
 		return err
 	}
 
-	oStmt, err := tx.PrepareContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2")
+	// final statuses are never left, otherwise a later transition into
+	// PROCESSED would credit the accrual twice
+	oStmt, err := tx.PrepareContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2 AND status NOT IN ($3, $4)")
 	if err != nil {
 		_ = tx.Rollback()
 		return err
 	}
 	defer oStmt.Close()
 
-	_, err = oStmt.ExecContext(ctx, status, orderID)
+	_, err = oStmt.ExecContext(ctx, status, orderID, models.PROCESSED, models.INVALID)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -185,6 +213,9 @@ func (s *Storage) LockOrders(ctx context.Context, tx *sql.Tx, orderID uint) erro
 	return s.lock(ctx, tx, orderID, "orders")
 }
 
+// UpdateOrderAccrualAndUserBalance stores the final accrual result. The user
+// balance is credited only when the order moves into PROCESSED from a
+// non-final status, so repeated calls for the same order are no-ops.
 func (s *Storage) UpdateOrderAccrualAndUserBalance(ctx context.Context, orderID uint, userID uint, accrualResp *services.CalcOrderAccrualResponse) error {
 	logger.Infof("UpdateOrderAccrualAndUserBalance params: orderID: %d, userID: %d", orderID, userID)
 
@@ -194,12 +225,23 @@ func (s *Storage) UpdateOrderAccrualAndUserBalance(ctx context.Context, orderID
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	err = s.LockOrders(ctx, tx, orderID)
+	var prevStatus models.OrderStatus
+	var ownerID uint
+	var number string
+	err = tx.QueryRowContext(ctx, "SELECT status, user_id, number FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&prevStatus, &ownerID, &number)
 	if err != nil {
-		_ = tx.Rollback()
 		return err
 	}
 
+	if ownerID != userID {
+		return fmt.Errorf("order %d does not belong to user %d", orderID, userID)
+	}
+
+	if prevStatus == models.PROCESSED || prevStatus == models.INVALID {
+		logger.Infof("UpdateOrderAccrualAndUserBalance: order %d is already %s, skipping", orderID, prevStatus)
+		return nil
+	}
+
 	oStmt, err := tx.PrepareContext(ctx, "UPDATE orders SET accrual = $1, status = $2 WHERE id = $3")
 	if err != nil {
 		_ = tx.Rollback()
@@ -213,23 +255,38 @@ func (s *Storage) UpdateOrderAccrualAndUserBalance(ctx context.Context, orderID
 		return err
 	}
 
-	err = s.LockUsers(ctx, tx, userID)
-	if err != nil {
-		_ = tx.Rollback()
-		return err
-	}
+	if accrualResp.Status == models.PROCESSED {
+		err = s.LockUsers(ctx, tx, userID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
 
-	uStmt, err := tx.PrepareContext(ctx, "UPDATE users SET balance = balance + $1 WHERE id = $2")
-	if err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-	defer uStmt.Close()
+		// accruals of deleted accounts are forfeited like their balance
+		uStmt, err := tx.PrepareContext(ctx, "UPDATE users SET balance = balance + $1 WHERE id = $2 AND deleted_at IS NULL")
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		defer uStmt.Close()
 
-	_, err = uStmt.ExecContext(ctx, accrualResp.Accrual, userID)
-	if err != nil {
-		_ = tx.Rollback()
-		return err
+		res, err := uStmt.ExecContext(ctx, accrualResp.Accrual, userID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		credited, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if credited > 0 && accrualResp.Accrual != 0 {
+			err = s.postLedger(ctx, tx, models.LedgerAccrual, accountAccruals, number, userID, accrualResp.Accrual)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	err = tx.Commit()
@@ -243,7 +300,7 @@ func (s *Storage) UpdateOrderAccrualAndUserBalance(ctx context.Context, orderID
 	return nil
 }
 
-func (s *Storage) WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount float64) error {
+func (s *Storage) WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount models.Money) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -254,9 +311,12 @@ func (s *Storage) WithdrawBalance(ctx context.Context, userID uint, orderNumber
 	if err != nil {
 		return err
 	}
+	if user == nil {
+		return ErrUserNotFound
+	}
 
 	logger.Infof(
-		"WithdrawBalance with: orderNumber: %s, withdrawalAmount: %f, userID: %d, userBalance: %f",
+		"WithdrawBalance with: orderNumber: %s, withdrawalAmount: %s, userID: %d, userBalance: %s",
 		orderNumber, withdrawalAmount, userID, user.Balance)
 
 	if user.Balance < withdrawalAmount {
@@ -285,6 +345,11 @@ func (s *Storage) WithdrawBalance(ctx context.Context, userID uint, orderNumber
 		return err
 	}
 
+	err = s.postLedger(ctx, tx, models.LedgerWithdrawal, accountWithdrawals, orderNumber, userID, -withdrawalAmount)
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		_ = tx.Rollback()
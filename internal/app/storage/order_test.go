@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestStorage_UpdateOrderAccrualAndUserBalanceCreditsOnce(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	user, err := s.CreateUser(ctx, "gopher", "hash")
+	assert.NoError(t, err)
+
+	order := createTestOrder(t, s, user.ID, "123456789106", models.PROCESSING)
+
+	first := &services.CalcOrderAccrualResponse{Order: order.Number, Accrual: models.MustParseMoney("100"), Status: models.PROCESSED}
+	assert.NoError(t, s.UpdateOrderAccrualAndUserBalance(ctx, order.ID, user.ID, first))
+
+	// a redelivered result, even with another amount, is a no-op
+	second := &services.CalcOrderAccrualResponse{Order: order.Number, Accrual: models.MustParseMoney("250"), Status: models.PROCESSED}
+	assert.NoError(t, s.UpdateOrderAccrualAndUserBalance(ctx, order.ID, user.ID, second))
+
+	stored, err := s.GetUserByID(nil, user.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MustParseMoney("100"), stored.Balance)
+
+	updated, err := s.GetOrderByNumber(nil, order.Number)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PROCESSED, updated.Status)
+	assert.Equal(t, models.MustParseMoney("100"), *updated.Accrual)
+
+	var entries int
+	assert.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM ledger_entries WHERE user_id = $1", user.ID).Scan(&entries))
+	assert.Equal(t, 1, entries)
+
+	drifts, err := s.ReconcileBalances(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, *drifts)
+}
+
+func TestStorage_UpdateOrderStatusKeepsFinalStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		from           models.OrderStatus
+		to             models.OrderStatus
+		expectedStatus models.OrderStatus
+	}{
+		{name: "New order starts processing", from: models.NEW, to: models.PROCESSING, expectedStatus: models.PROCESSING},
+		{name: "Processing order is invalidated", from: models.PROCESSING, to: models.INVALID, expectedStatus: models.INVALID},
+		{name: "Processed order stays processed", from: models.PROCESSED, to: models.PROCESSING, expectedStatus: models.PROCESSED},
+		{name: "Processed order is not invalidated", from: models.PROCESSED, to: models.INVALID, expectedStatus: models.PROCESSED},
+		{name: "Invalid order stays invalid", from: models.INVALID, to: models.NEW, expectedStatus: models.INVALID},
+		{name: "Invalid order is not processed", from: models.INVALID, to: models.PROCESSED, expectedStatus: models.INVALID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			ctx := context.Background()
+
+			user, err := s.CreateUser(ctx, "gopher", "hash")
+			assert.NoError(t, err)
+
+			order := createTestOrder(t, s, user.ID, "123456789106", tt.from)
+			assert.NoError(t, s.UpdateOrderStatus(ctx, order.ID, tt.to))
+
+			updated, err := s.GetOrderByNumber(nil, order.Number)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, updated.Status)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/vtcaregorodtcev/gophermarket/internal/app/services"
@@ -19,13 +20,40 @@ type Storager interface {
 	GetUserByID(tx *sql.Tx, id uint, forUpdate bool) (*models.User, error)
 	GetUserByLogin(tx *sql.Tx, login string) (*models.User, error)
 	CreateUser(ctx context.Context, login, password string) (*models.User, error)
+	UpdateUserPassword(ctx context.Context, userID uint, password string) error
+	ChangeUserPassword(ctx context.Context, userID uint, password, keepSessionID string) error
+	GetAccount(ctx context.Context, userID uint) (*models.Account, error)
+	DeleteUser(ctx context.Context, userID uint) error
+	SetUserRoles(ctx context.Context, userID uint, roles []string) error
+	CreateRefreshToken(ctx context.Context, userID uint, sessionID, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.RefreshToken, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	IsSessionActive(ctx context.Context, userID uint, sessionID string) (bool, error)
 	GetOrderByNumber(tx *sql.Tx, orderNumber string) (*models.Order, error)
 	CreateOrder(ctx context.Context, orderNumber string, userID uint) (*models.Order, error)
 	UpdateOrderAccrualAndUserBalance(ctx context.Context, orderID uint, userID uint, accrualResp *services.CalcOrderAccrualResponse) error
 	GetOrdersByUserID(userID uint) (*[](*models.Order), error)
-	WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount float64) error
+	GetOrders(ctx context.Context, filter models.OrderFilter) (*[](*models.Order), error)
+	WithdrawBalance(ctx context.Context, userID uint, orderNumber string, withdrawalAmount models.Money) error
 	GetUserWithdrawals(userID uint) (*[](*models.Withdrawal), error)
+	AdjustBalance(ctx context.Context, adj *models.BalanceAdjustment) (*models.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, filter models.AdjustmentFilter) (*[](*models.BalanceAdjustment), error)
+	ReconcileBalances(ctx context.Context) (*[](*models.BalanceDrift), error)
+	GetBalanceHistory(ctx context.Context, filter models.BalanceHistoryFilter) (*[](*models.BalanceEvent), error)
+	GetWithdrawals(ctx context.Context, filter models.WithdrawalFilter) (*[](*models.Withdrawal), error)
+	SearchUsers(ctx context.Context, query string, limit int) (*[](*models.UserSummary), error)
 	UpdateOrderStatus(ctx context.Context, orderID uint, status models.OrderStatus) error
+	ClaimAccrualJobs(ctx context.Context, limit int, lease time.Duration) (*[](*models.AccrualJob), error)
+	CompleteAccrualJob(ctx context.Context, jobID uint) error
+	RescheduleAccrualJob(ctx context.Context, jobID uint, delay time.Duration, lastError string) error
+	RecoverAccrualJobs(ctx context.Context, limit int) (int, error)
+	RecordAccrualAttempt(ctx context.Context, attempt *models.AccrualAttempt) error
+	GetAccrualHistory(ctx context.Context, orderNumber string) (*models.AccrualHistory, error)
+	CreateRewardRule(ctx context.Context, rule *models.RewardRule) (*models.RewardRule, error)
+	GetRewardRules(ctx context.Context) (*[](*models.RewardRule), error)
+	DeleteRewardRule(ctx context.Context, ruleID uint) error
+	CreateRewardOrder(ctx context.Context, order *models.RewardOrder) error
+	GetRewardOrder(ctx context.Context, orderNumber string) (*models.RewardOrder, error)
 }
 
 type Storage struct {
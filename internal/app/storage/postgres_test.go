@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+// newTestStorage connects to the database at TEST_DATABASE_URI and recreates
+// the schema from scratch, so it must point to a disposable database. Tests
+// that need it are skipped when it isn't set.
+func newTestStorage(t *testing.T) *Storage {
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if len(uri) == 0 {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	init, err := os.ReadFile(filepath.Join("..", "..", "..", "migrations", "init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(string(init)); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Storage{db: db}
+}
+
+func createTestOrder(t *testing.T, s *Storage, userID uint, number string, status models.OrderStatus) *models.Order {
+	order, err := s.CreateOrder(context.Background(), number, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.db.Exec("UPDATE orders SET status = $1 WHERE id = $2", status, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	order.Status = status
+
+	return order
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+var ErrRewardRuleExists = errors.New("reward rule already exists")
+var ErrRewardRuleNotFound = errors.New("reward rule not found")
+
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+func (s *Storage) CreateRewardRule(ctx context.Context, rule *models.RewardRule) (*models.RewardRule, error) {
+	query := `INSERT INTO reward_rules (match, reward, reward_type) VALUES ($1, $2, $3) RETURNING id`
+
+	created := *rule
+	err := s.db.QueryRowContext(ctx, query, rule.Match, rule.Reward, rule.RewardType).Scan(&created.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrRewardRuleExists
+		}
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (s *Storage) GetRewardRules(ctx context.Context) (*[](*models.RewardRule), error) {
+	rules := make([]*models.RewardRule, 0)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			id,
+			match,
+			reward,
+			reward_type
+		FROM
+			reward_rules
+		ORDER BY
+			id ASC
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.RewardRule
+		if err := rows.Scan(&rule.ID, &rule.Match, &rule.Reward, &rule.RewardType); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+func (s *Storage) DeleteRewardRule(ctx context.Context, ruleID uint) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM reward_rules WHERE id = $1`, ruleID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrRewardRuleNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateRewardOrder(ctx context.Context, order *models.RewardOrder) error {
+	goods, err := json.Marshal(order.Goods)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO reward_orders (number, goods) VALUES ($1, $2)`, order.Number, goods)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrOrderAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRewardOrder(ctx context.Context, orderNumber string) (*models.RewardOrder, error) {
+	var goods []byte
+
+	order := &models.RewardOrder{}
+	err := s.db.QueryRowContext(ctx, `SELECT number, goods FROM reward_orders WHERE number = $1`, orderNumber).Scan(&order.Number, &goods)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Order not found
+		}
+		return nil, err
+	}
+
+	order.Goods, err = decodeGoods(goods)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// decodeGoods reads goods stored as JSON. Orders registered while prices
+// were floats may have more than two fractional digits, those are rounded
+// rather than left unreadable.
+func decodeGoods(data []byte) ([]models.Good, error) {
+	var raw []struct {
+		Description string      `json:"description"`
+		Price       json.Number `json:"price"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	goods := make([]models.Good, len(raw))
+	for i, g := range raw {
+		price, err := models.RoundMoney(g.Price.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid price %s: %w", g.Price, err)
+		}
+		goods[i] = models.Good{Description: g.Description, Price: price}
+	}
+
+	return goods, nil
+}
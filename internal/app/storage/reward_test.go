@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+func TestDecodeGoods(t *testing.T) {
+	goods, err := decodeGoods([]byte(`[{"description":"Чайник Bork","price":7000},{"description":"Mug","price":33.335}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Good{
+		{Description: "Чайник Bork", Price: models.MustParseMoney("7000")},
+		{Description: "Mug", Price: models.MustParseMoney("33.34")},
+	}, goods)
+
+	_, err = decodeGoods([]byte(`[{"description":"Mug","price":"cheap"}]`))
+	assert.Error(t, err)
+}
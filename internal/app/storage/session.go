@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vtcaregorodtcev/gophermarket/internal/logger"
+	"github.com/vtcaregorodtcev/gophermarket/internal/models"
+)
+
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+func (s *Storage) CreateRefreshToken(ctx context.Context, userID uint, sessionID, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)
+	`, userID, sessionID, tokenHash, expiresAt)
+
+	return err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one of the same
+// session. A token can be exchanged only once: presenting it again means it
+// leaked, so the whole session is revoked.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			id,
+			user_id,
+			session_id,
+			expires_at,
+			used_at,
+			revoked_at
+		FROM
+			refresh_tokens
+		WHERE
+			token_hash = $1
+		FOR UPDATE
+	`, oldHash).Scan(&token.ID, &token.UserID, &token.SessionID, &token.ExpiresAt, &usedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid || time.Now().After(token.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if usedAt.Valid {
+		logger.Infof("RotateRefreshToken: reuse detected, revoking session %s of user %d", token.SessionID, token.UserID)
+
+		_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE session_id = $1 AND revoked_at IS NULL`, token.SessionID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE id = $1`, token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id
+	`, token.UserID, token.SessionID, newHash, expiresAt).Scan(&token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ExpiresAt = expiresAt
+
+	return &token, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE session_id = $1 AND revoked_at IS NULL`, sessionID)
+	return err
+}
+
+// IsSessionActive reports whether the session still has a refresh token that
+// can be exchanged and belongs to an account that wasn't deleted. Logout,
+// password changes, account deletion and reuse detection revoke those tokens,
+// which ends the access tokens of the session as well.
+func (s *Storage) IsSessionActive(ctx context.Context, userID uint, sessionID string) (bool, error) {
+	var active bool
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT
+				1
+			FROM
+				refresh_tokens r
+				JOIN users u ON u.id = r.user_id
+			WHERE
+				r.user_id = $1
+				AND r.session_id = $2
+				AND u.deleted_at IS NULL
+				AND r.revoked_at IS NULL
+				AND r.used_at IS NULL
+				AND r.expires_at > now()
+		)
+	`, userID, sessionID).Scan(&active)
+
+	return active, err
+}
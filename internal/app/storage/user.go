@@ -3,11 +3,16 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/lib/pq"
 	"github.com/vtcaregorodtcev/gophermarket/internal/models"
 )
 
+var ErrLoginTaken = errors.New("login is already taken")
+
 func (s *Storage) CreateUser(ctx context.Context, login, password string) (*models.User, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -20,6 +25,9 @@ func (s *Storage) CreateUser(ctx context.Context, login, password string) (*mode
 	err = tx.QueryRowContext(ctx, query, login, password).Scan(&id)
 
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrLoginTaken
+		}
 		return nil, err
 	}
 
@@ -35,8 +43,13 @@ func (s *Storage) CreateUser(ctx context.Context, login, password string) (*mode
 	}, nil
 }
 
+func (s *Storage) UpdateUserPassword(ctx context.Context, userID uint, password string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", password, userID)
+	return err
+}
+
 func (s *Storage) getUserBy(tx *sql.Tx, by, what string, forUpdate bool) (*models.User, error) {
-	query := "SELECT id, login, password, balance, withdrawn FROM users WHERE " + by + " = $1"
+	query := "SELECT id, login, password, balance, withdrawn, roles FROM users WHERE " + by + " = $1 AND deleted_at IS NULL"
 
 	if forUpdate {
 		query += " FOR UPDATE"
@@ -50,7 +63,7 @@ func (s *Storage) getUserBy(tx *sql.Tx, by, what string, forUpdate bool) (*model
 	}
 
 	user := &models.User{}
-	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Balance, &user.Withdrawn)
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.Balance, &user.Withdrawn, pq.Array(&user.Roles))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // User not found
@@ -62,7 +75,8 @@ func (s *Storage) getUserBy(tx *sql.Tx, by, what string, forUpdate bool) (*model
 }
 
 func (s *Storage) GetUserByLogin(tx *sql.Tx, login string) (*models.User, error) {
-	return s.getUserBy(tx, "login", login, false)
+	// logins are unique regardless of case, see users_login_lower_idx
+	return s.getUserBy(tx, "LOWER(login)", strings.ToLower(login), false)
 }
 
 func (s *Storage) GetUserByID(tx *sql.Tx, id uint, forUpdate bool) (*models.User, error) {
@@ -70,20 +84,24 @@ func (s *Storage) GetUserByID(tx *sql.Tx, id uint, forUpdate bool) (*models.User
 }
 
 func (s *Storage) GetUserWithdrawals(userID uint) (*[](*models.Withdrawal), error) {
+	return s.GetWithdrawals(context.Background(), models.WithdrawalFilter{UserID: userID})
+}
+
+func (s *Storage) GetWithdrawals(ctx context.Context, filter models.WithdrawalFilter) (*[](*models.Withdrawal), error) {
 	withdrawals := make([]*models.Withdrawal, 0)
+	w := withdrawalWhere(filter)
 
-	rows, err := s.db.Query(`
+	rows, err := s.db.QueryContext(ctx, `
 		SELECT
+			id,
 			order_id,
 			sum,
 			processed_at
 		FROM
 			withdrawals
-		WHERE
-			user_id = $1
-		ORDER BY
-			processed_at ASC
-	`, userID)
+		`+w.String()+`
+		`+orderBy("processed_at", filter.Desc)+`
+		`+limit(filter.Limit), w.args...)
 
 	if err != nil {
 		return nil, err
@@ -92,7 +110,7 @@ func (s *Storage) GetUserWithdrawals(userID uint) (*[](*models.Withdrawal), erro
 
 	for rows.Next() {
 		var withdrawal models.Withdrawal
-		if err := rows.Scan(&withdrawal.OrderNumber, &withdrawal.Sum, &withdrawal.ProcessedAt); err != nil {
+		if err := rows.Scan(&withdrawal.ID, &withdrawal.OrderNumber, &withdrawal.Sum, &withdrawal.ProcessedAt); err != nil {
 			return nil, err
 		}
 		withdrawals = append(withdrawals, &withdrawal)
@@ -104,3 +122,61 @@ func (s *Storage) GetUserWithdrawals(userID uint) (*[](*models.Withdrawal), erro
 
 	return &withdrawals, nil
 }
+
+// SetUserRoles replaces the roles of a user and revokes all of their
+// sessions, so tokens carrying the old roles stop working right away and the
+// user logs in again to get the new ones.
+func (s *Storage) SetUserRoles(ctx context.Context, userID uint, roles []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET roles = $1 WHERE id = $2 AND deleted_at IS NULL`, pq.Array(roles), userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GrantRoleByLogin is used to bootstrap the first admins from configuration.
+func (s *Storage) GrantRoleByLogin(ctx context.Context, login, role string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE users SET roles = array_append(roles, $2)
+		WHERE LOWER(login) = LOWER($1) AND deleted_at IS NULL AND NOT ($2 = ANY(roles))
+	`, login, role)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		user, err := s.GetUserByLogin(nil, login)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = loadCommonPasswords()
+
+func loadCommonPasswords() map[string]struct{} {
+	passwords := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+	for scanner.Scan() {
+		if p := strings.TrimSpace(scanner.Text()); len(p) > 0 {
+			passwords[strings.ToLower(p)] = struct{}{}
+		}
+	}
+
+	return passwords
+}
+
+const (
+	LoginMinLength = 3
+	LoginMaxLength = 64
+	// PasswordMaxLength keeps hashing cost bounded.
+	PasswordMaxLength = 128
+)
+
+var loginRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols a
+	// password must mix.
+	MinClasses int
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MinClasses: 2}
+
+var (
+	passwordPolicyMu sync.RWMutex
+	passwordPolicy   = DefaultPasswordPolicy
+)
+
+func SetPasswordPolicy(p PasswordPolicy) {
+	passwordPolicyMu.Lock()
+	defer passwordPolicyMu.Unlock()
+
+	passwordPolicy = p
+}
+
+func getPasswordPolicy() PasswordPolicy {
+	passwordPolicyMu.RLock()
+	defer passwordPolicyMu.RUnlock()
+
+	return passwordPolicy
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// NormalizeLogin makes logins case-insensitive, so it has to be applied
+// everywhere a login is stored or looked up.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// ValidateCredentials expects an already normalized login.
+func ValidateCredentials(login, password string) FieldErrors {
+	var errs FieldErrors
+
+	if msg := validateLogin(login); len(msg) > 0 {
+		errs = append(errs, FieldError{Field: "login", Message: msg})
+	}
+
+	if msg := ValidatePassword(password); len(msg) > 0 {
+		errs = append(errs, FieldError{Field: "password", Message: msg})
+	}
+
+	return errs
+}
+
+func validateLogin(login string) string {
+	switch {
+	case len(login) < LoginMinLength || len(login) > LoginMaxLength:
+		return fmt.Sprintf("must be %d to %d characters long", LoginMinLength, LoginMaxLength)
+	case !loginRe.MatchString(login):
+		return "may contain only latin letters, digits, '.', '_' and '-' and must start with a letter or digit"
+	}
+
+	return ""
+}
+
+// ValidatePassword returns an empty string for a password that satisfies the
+// configured policy.
+func ValidatePassword(password string) string {
+	policy := getPasswordPolicy()
+	length := utf8.RuneCountInString(password)
+
+	switch {
+	case length < policy.MinLength:
+		return fmt.Sprintf("must be at least %d characters long", policy.MinLength)
+	case length > PasswordMaxLength:
+		return fmt.Sprintf("must be at most %d characters long", PasswordMaxLength)
+	case characterClasses(password) < policy.MinClasses:
+		return fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", policy.MinClasses)
+	case isCommonPassword(password):
+		return "is too common"
+	}
+
+	return ""
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+func isCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
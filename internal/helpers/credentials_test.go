@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		fields   []string
+	}{
+		{name: "Valid", login: "john.doe-1", password: "Str0ng-passw0rd"},
+		{name: "Unicode password", login: "john", password: "пароль-длинный"},
+		{name: "Short login", login: "jo", password: "Str0ng-passw0rd", fields: []string{"login"}},
+		{name: "Long login", login: string(make([]byte, LoginMaxLength+1)), password: "Str0ng-passw0rd", fields: []string{"login"}},
+		{name: "Login starts with a dot", login: ".john", password: "Str0ng-passw0rd", fields: []string{"login"}},
+		{name: "Uppercase login isn't normalized", login: "John", password: "Str0ng-passw0rd", fields: []string{"login"}},
+		{name: "Short password", login: "john", password: "Ab1", fields: []string{"password"}},
+		{name: "One character class", login: "john", password: "abcdefghijk", fields: []string{"password"}},
+		{name: "Common password in other case", login: "john", password: "PASSWORD123", fields: []string{"password"}},
+		{name: "Both invalid", login: "j", password: "a", fields: []string{"login", "password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, fe := range ValidateCredentials(tt.login, tt.password) {
+				fields = append(fields, fe.Field)
+			}
+
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestNormalizeLogin(t *testing.T) {
+	assert.Equal(t, "john.doe", NormalizeLogin("  John.DOE "))
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns the position of the last item of a page into an opaque
+// token clients pass back to get the next page.
+func EncodeCursor(position interface{}) (string, error) {
+	b, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor reads a token made by EncodeCursor into position. Tokens that
+// weren't made for the same position type are rejected.
+func DecodeCursor(cursor string, position interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(position); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	type position struct {
+		ID uint `json:"id"`
+	}
+
+	cursor, err := EncodeCursor(position{ID: 42})
+	assert.NoError(t, err)
+
+	var p position
+	assert.NoError(t, DecodeCursor(cursor, &p))
+	assert.Equal(t, position{ID: 42}, p)
+
+	for _, bad := range []string{"%%%", "bm90IGpzb24", "eyJpZCI6Ii0xIn0", "eyJvdGhlciI6MX0"} {
+		assert.ErrorIs(t, DecodeCursor(bad, &p), ErrInvalidCursor, bad)
+	}
+}
@@ -1,36 +1,105 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-const JwtSecret = "JWT_SECRET"
+var (
+	AccessTokenTTL  = time.Minute * 15
+	RefreshTokenTTL = time.Hour * 24 * 30
+)
 
-func GetJWTByID(id uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id": id,
+// NewAccessToken issues a short-lived token bound to the session the
+// refresh token family belongs to.
+func NewAccessToken(id uint, login string, roles []string, sessionID string) (string, error) {
+	ks, err := getJWTKeys()
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	key := ks.active()
+	now := time.Now()
+
+	token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
+		"id":    id,
+		"login": login,
+		"roles": roles,
+		"sid":   sessionID,
+		"jti":   jti,
+		"iat":   now.Unix(),
+		"exp":   now.Add(AccessTokenTTL).Unix(),
 	})
+	token.Header["kid"] = key.ID
 
-	return token.SignedString([]byte(JwtSecret))
+	return token.SignedString(key.SignKey)
 }
 
 func ValidateJWT(tokenString string) (jwt.Claims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(JwtSecret), nil
-	})
+	ks, err := getJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(tokenString, ks.lookup)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	} else {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
 		return nil, fmt.Errorf("invalid token")
 	}
+
+	return claims, nil
+}
+
+func GetJWKS() (map[string]interface{}, error) {
+	ks, err := getJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return ks.JWKS(), nil
+}
+
+// NewRefreshToken returns an opaque token for the client and the hash to
+// keep on the server side.
+func NewRefreshToken() (token string, hash string, err error) {
+	token, err = randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewSessionID() (string, error) {
+	return randomToken(16)
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
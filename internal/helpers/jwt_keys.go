@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type JWTKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// SignKey is nil for keys that only verify tokens, e.g. a retired key
+	// or a public key of another issuer.
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// JWTKeySet holds every key accepted for verification. New tokens are
+// signed with the active key and carry its id in the kid header, so keys
+// can be rotated without invalidating tokens signed with older ones.
+type JWTKeySet struct {
+	activeID string
+	keys     map[string]*JWTKey
+}
+
+type jwtKeyFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID             string `json:"kid"`
+		Alg            string `json:"alg"`
+		Secret         string `json:"secret"`
+		PrivateKeyFile string `json:"private_key_file"`
+		PublicKeyFile  string `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+var (
+	jwtKeysMu sync.RWMutex
+	jwtKeys   *JWTKeySet
+)
+
+func NewJWTKeySet(activeID string, keys ...*JWTKey) (*JWTKeySet, error) {
+	ks := &JWTKeySet{activeID: activeID, keys: make(map[string]*JWTKey, len(keys))}
+
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate jwt key id: %s", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active jwt key %q is not defined", activeID)
+	}
+	if active.SignKey == nil {
+		return nil, fmt.Errorf("active jwt key %q has no private key", activeID)
+	}
+
+	return ks, nil
+}
+
+func NewHMACKeySet(secret string) (*JWTKeySet, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("jwt secret must be at least 32 bytes long")
+	}
+
+	return NewJWTKeySet("default", &JWTKey{
+		ID:        "default",
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   []byte(secret),
+		VerifyKey: []byte(secret),
+	})
+}
+
+// LoadJWTKeySet reads a JSON key file like
+//
+//	{
+//	  "active": "2024-06",
+//	  "keys": [
+//	    {"kid": "2024-01", "alg": "HS256", "secret": "..."},
+//	    {"kid": "2024-06", "alg": "RS256", "private_key_file": "rs256.pem"},
+//	    {"kid": "partner", "alg": "EdDSA", "public_key_file": "partner.pub"}
+//	  ]
+//	}
+func LoadJWTKeySet(file string) (*JWTKeySet, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read jwt key file: %w", err)
+	}
+
+	var kf jwtKeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("cannot parse jwt key file: %w", err)
+	}
+
+	keys := make([]*JWTKey, 0, len(kf.Keys))
+	for _, k := range kf.Keys {
+		if len(k.ID) == 0 {
+			return nil, errors.New("jwt key without kid")
+		}
+
+		key := &JWTKey{ID: k.ID}
+
+		switch k.Alg {
+		case "HS256":
+			if len(k.Secret) < 32 {
+				return nil, fmt.Errorf("jwt key %s: secret must be at least 32 bytes long", k.ID)
+			}
+			key.Method = jwt.SigningMethodHS256
+			key.SignKey = []byte(k.Secret)
+			key.VerifyKey = []byte(k.Secret)
+		case "RS256":
+			key.Method = jwt.SigningMethodRS256
+			err = loadRSAKey(key, k.PrivateKeyFile, k.PublicKeyFile)
+		case "EdDSA":
+			key.Method = EdDSASigningMethod
+			err = loadEd25519Key(key, k.PrivateKeyFile, k.PublicKeyFile)
+		default:
+			return nil, fmt.Errorf("jwt key %s: unsupported alg %q", k.ID, k.Alg)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", k.ID, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewJWTKeySet(kf.Active, keys...)
+}
+
+func loadRSAKey(key *JWTKey, privateFile, publicFile string) error {
+	if len(privateFile) > 0 {
+		data, err := os.ReadFile(privateFile)
+		if err != nil {
+			return err
+		}
+
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+
+		key.SignKey = private
+		key.VerifyKey = &private.PublicKey
+		return nil
+	}
+
+	data, err := os.ReadFile(publicFile)
+	if err != nil {
+		return err
+	}
+
+	public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		return err
+	}
+
+	key.VerifyKey = public
+	return nil
+}
+
+func loadEd25519Key(key *JWTKey, privateFile, publicFile string) error {
+	if len(privateFile) > 0 {
+		block, err := readPEM(privateFile)
+		if err != nil {
+			return err
+		}
+
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return errors.New("not an Ed25519 private key")
+		}
+
+		key.SignKey = private
+		key.VerifyKey = private.Public()
+		return nil
+	}
+
+	block, err := readPEM(publicFile)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	public, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("not an Ed25519 public key")
+	}
+
+	key.VerifyKey = public
+	return nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	return block, nil
+}
+
+// NewRandomHMACKeySet is a fallback for development: tokens signed with it
+// become invalid on restart.
+func NewRandomHMACKeySet() (*JWTKeySet, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return NewHMACKeySet(base64.RawStdEncoding.EncodeToString(secret))
+}
+
+func SetJWTKeys(ks *JWTKeySet) {
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+
+	jwtKeys = ks
+}
+
+func getJWTKeys() (*JWTKeySet, error) {
+	jwtKeysMu.RLock()
+	ks := jwtKeys
+	jwtKeysMu.RUnlock()
+
+	if ks != nil {
+		return ks, nil
+	}
+
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+
+	if jwtKeys == nil {
+		ks, err := NewRandomHMACKeySet()
+		if err != nil {
+			return nil, err
+		}
+		jwtKeys = ks
+	}
+
+	return jwtKeys, nil
+}
+
+func (ks *JWTKeySet) active() *JWTKey {
+	return ks.keys[ks.activeID]
+}
+
+func (ks *JWTKeySet) lookup(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if len(kid) == 0 {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.VerifyKey, nil
+}
+
+// JWKS returns the public keys of the set in the JSON Web Key Set format.
+// Symmetric keys are never published.
+func (ks *JWTKeySet) JWKS() map[string]interface{} {
+	keys := make([]map[string]string, 0)
+
+	for _, key := range ks.keys {
+		switch public := key.VerifyKey.(type) {
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"alg": key.Method.Alg(),
+				"use": "sig",
+				"kid": key.ID,
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"alg": key.Method.Alg(),
+				"use": "sig",
+				"kid": key.ID,
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
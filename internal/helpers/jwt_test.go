@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey := &JWTKey{ID: "old", Method: jwt.SigningMethodHS256, SignKey: []byte("0123456789abcdef0123456789abcdef"), VerifyKey: []byte("0123456789abcdef0123456789abcdef")}
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey := &JWTKey{ID: "new", Method: jwt.SigningMethodRS256, SignKey: rsaKey, VerifyKey: &rsaKey.PublicKey}
+
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	edKey := &JWTKey{ID: "ed", Method: EdDSASigningMethod, SignKey: privateKey, VerifyKey: publicKey}
+
+	ks, err := NewJWTKeySet("old", oldKey)
+	assert.NoError(t, err)
+	SetJWTKeys(ks)
+
+	oldToken, err := NewAccessToken(1, "user1", nil, "s1")
+	assert.NoError(t, err)
+
+	ks, err = NewJWTKeySet("new", oldKey, newKey)
+	assert.NoError(t, err)
+	SetJWTKeys(ks)
+
+	newToken, err := NewAccessToken(2, "user2", nil, "s2")
+	assert.NoError(t, err)
+
+	claims, err := ValidateJWT(oldToken)
+	assert.NoError(t, err, "tokens signed with a retired key stay valid")
+	assert.Equal(t, float64(1), claims.(jwt.MapClaims)["id"])
+
+	claims, err = ValidateJWT(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), claims.(jwt.MapClaims)["id"])
+
+	ks, err = NewJWTKeySet("ed", edKey)
+	assert.NoError(t, err)
+	SetJWTKeys(ks)
+
+	edToken, err := NewAccessToken(3, "user3", nil, "s3")
+	assert.NoError(t, err)
+
+	_, err = ValidateJWT(edToken)
+	assert.NoError(t, err)
+
+	_, err = ValidateJWT(oldToken)
+	assert.Error(t, err, "tokens signed with a dropped key are rejected")
+
+	expired := jwt.NewWithClaims(EdDSASigningMethod, jwt.MapClaims{"id": 1, "exp": time.Now().Add(-time.Minute).Unix()})
+	expired.Header["kid"] = "ed"
+	expiredString, _ := expired.SignedString(privateKey)
+
+	_, err = ValidateJWT(expiredString)
+	assert.Error(t, err, "expired tokens are rejected")
+
+	noExp := jwt.NewWithClaims(EdDSASigningMethod, jwt.MapClaims{"id": 1})
+	noExp.Header["kid"] = "ed"
+	noExpString, _ := noExp.SignedString(privateKey)
+
+	_, err = ValidateJWT(noExpString)
+	assert.Error(t, err, "tokens without exp are rejected")
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 1, "exp": time.Now().Add(time.Minute).Unix()})
+	forged.Header["kid"] = "ed"
+	forgedString, _ := forged.SignedString([]byte(publicKey))
+
+	_, err = ValidateJWT(forgedString)
+	assert.Error(t, err, "algorithm must match the key")
+
+	_, err = NewJWTKeySet("ed", &JWTKey{ID: "ed", Method: EdDSASigningMethod, VerifyKey: publicKey})
+	assert.Error(t, err, "active key must be able to sign")
+
+	jwks := ks.JWKS()["keys"].([]map[string]string)
+	assert.Len(t, jwks, 1)
+	assert.Equal(t, "OKP", jwks[0]["kty"])
+}
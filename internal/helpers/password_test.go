@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePassword(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 12, MinClasses: 3}
+	lax := PasswordPolicy{MinLength: 1, MinClasses: 0}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		message  string
+	}{
+		{name: "Valid", policy: DefaultPasswordPolicy, password: "Str0ngpass"},
+		{name: "Too short", policy: DefaultPasswordPolicy, password: "Ab1", message: "must be at least 8 characters long"},
+		{name: "Length is counted in characters", policy: DefaultPasswordPolicy, password: "пароль1", message: "must be at least 8 characters long"},
+		{name: "Unicode password", policy: DefaultPasswordPolicy, password: "пароль-длинный"},
+		{name: "Too long", policy: DefaultPasswordPolicy, password: strings.Repeat("Ab1", 43), message: "must be at most 128 characters long"},
+		{name: "Single character class", policy: DefaultPasswordPolicy, password: "abcdefghijk", message: "must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"},
+		{name: "Digits only", policy: DefaultPasswordPolicy, password: "5550172839", message: "must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"},
+		{name: "Common password", policy: DefaultPasswordPolicy, password: "1q2w3e4r", message: "is too common"},
+		{name: "Common password in other case", policy: DefaultPasswordPolicy, password: "Password1", message: "is too common"},
+		{name: "Stricter length", policy: strict, password: "Str0ngpass", message: "must be at least 12 characters long"},
+		{name: "Stricter classes", policy: strict, password: "strongpassword1", message: "must mix at least 3 of lowercase letters, uppercase letters, digits and symbols"},
+		{name: "Symbols are a class", policy: strict, password: "Strong-password"},
+		{name: "No class requirement", policy: lax, password: "a"},
+		{name: "Empty password", policy: lax, password: "", message: "must be at least 1 characters long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPasswordPolicy(tt.policy)
+			t.Cleanup(func() { SetPasswordPolicy(DefaultPasswordPolicy) })
+
+			assert.Equal(t, tt.message, ValidatePassword(tt.password))
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("Str0ngpass")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$"))
+
+	other, err := HashPassword("Str0ngpass")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt is random")
+
+	tests := []struct {
+		name        string
+		stored      string
+		password    string
+		ok          bool
+		needsRehash bool
+	}{
+		{name: "Matching password", stored: hash, password: "Str0ngpass", ok: true},
+		{name: "Wrong password", stored: hash, password: "Str0ngpasS"},
+		{name: "Legacy plaintext", stored: "Str0ngpass", password: "Str0ngpass", ok: true, needsRehash: true},
+		{name: "Wrong legacy plaintext", stored: "Str0ngpass", password: "other"},
+		{name: "Malformed hash", stored: "$argon2id$v=19$m=65536", password: "Str0ngpass"},
+		{name: "Unsupported version", stored: strings.Replace(hash, "v=19", "v=16", 1), password: "Str0ngpass"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := VerifyPassword(tt.stored, tt.password)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.needsRehash, needsRehash)
+		})
+	}
+}
+
+func TestVerifyPasswordOutdatedParams(t *testing.T) {
+	params := PasswordHashParams
+	t.Cleanup(func() { PasswordHashParams = params })
+
+	PasswordHashParams.Memory = 32 * 1024
+	hash, err := HashPassword("Str0ngpass")
+	assert.NoError(t, err)
+
+	PasswordHashParams = params
+	ok, needsRehash := VerifyPassword(hash, "Str0ngpass")
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+}
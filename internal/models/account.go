@@ -0,0 +1,12 @@
+package models
+
+import (
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+type Account struct {
+	Login            string              `json:"login"`
+	RegisteredAt     helpers.RFC3339Time `json:"registered_at"`
+	OrdersCount      int                 `json:"orders_count"`
+	WithdrawalsCount int                 `json:"withdrawals_count"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+type AdjustmentReason string
+
+const (
+	AdjustmentLostAccrual   AdjustmentReason = "lost_accrual"
+	AdjustmentFraudReversal AdjustmentReason = "fraud_reversal"
+	AdjustmentGoodwill      AdjustmentReason = "goodwill"
+	AdjustmentCorrection    AdjustmentReason = "correction"
+)
+
+func (r AdjustmentReason) Valid() bool {
+	switch r {
+	case AdjustmentLostAccrual, AdjustmentFraudReversal, AdjustmentGoodwill, AdjustmentCorrection:
+		return true
+	}
+
+	return false
+}
+
+// BalanceAdjustment is a manual credit (positive Amount) or debit (negative
+// Amount) made by an operator.
+type BalanceAdjustment struct {
+	ID         uint                `json:"id"`
+	UserID     uint                `json:"user_id,omitempty"`
+	OperatorID uint                `json:"operator_id,omitempty"`
+	Amount     Money               `json:"amount"`
+	Reason     AdjustmentReason    `json:"reason"`
+	Comment    string              `json:"comment"`
+	CreatedAt  helpers.RFC3339Time `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// ListPosition is where a keyset paginated listing stopped: the sort time
+// and the id of the last item returned. Desc and Filter tie it to the query
+// that produced it, a position only makes sense in the same ordering and
+// filtered set.
+type ListPosition struct {
+	Time   time.Time `json:"t"`
+	ID     uint      `json:"id"`
+	Desc   bool      `json:"desc,omitempty"`
+	Filter string    `json:"f,omitempty"`
+}
+
+// OrderFilter narrows order listings. Zero values don't filter.
+type OrderFilter struct {
+	UserID   uint
+	Statuses []OrderStatus
+	From     time.Time
+	To       time.Time
+	// Desc lists the newest orders first.
+	Desc  bool
+	After *ListPosition
+	Limit int
+}
+
+type WithdrawalFilter struct {
+	UserID uint
+	From   time.Time
+	To     time.Time
+	Desc   bool
+	After  *ListPosition
+	Limit  int
+}
+
+type AdjustmentFilter struct {
+	UserID uint
+	From   time.Time
+	To     time.Time
+	Desc   bool
+	After  *ListPosition
+	Limit  int
+}
+
+// BalanceHistoryFilter pages through a user's balance events in chronological
+// order, starting after the event AfterID.
+type BalanceHistoryFilter struct {
+	UserID  uint
+	From    time.Time
+	To      time.Time
+	AfterID uint
+	Limit   int
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+type AccrualJob struct {
+	ID        uint
+	Attempts  int
+	LastError *string
+	Order     Order
+}
+
+// AccrualAttempt is one call to the accrual system made for an order.
+type AccrualAttempt struct {
+	ID        uint                `json:"id"`
+	OrderID   uint                `json:"-"`
+	Outcome   string              `json:"outcome"`
+	Status    *OrderStatus        `json:"status,omitempty"`
+	Accrual   *Money              `json:"accrual,omitempty"`
+	Error     *string             `json:"error,omitempty"`
+	CreatedAt helpers.RFC3339Time `json:"created_at"`
+}
+
+type AccrualJobState struct {
+	Attempts    int                  `json:"attempts"`
+	NextRunAt   helpers.RFC3339Time  `json:"next_run_at"`
+	CompletedAt *helpers.RFC3339Time `json:"completed_at,omitempty"`
+	LastError   *string              `json:"last_error,omitempty"`
+}
+
+type AccrualHistory struct {
+	Order    Order             `json:"order"`
+	Job      *AccrualJobState  `json:"job,omitempty"`
+	Attempts []*AccrualAttempt `json:"attempts"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+type LedgerKind string
+
+const (
+	LedgerAccrual    LedgerKind = "accrual"
+	LedgerWithdrawal LedgerKind = "withdrawal"
+	LedgerAdjustment LedgerKind = "adjustment"
+	LedgerReversal   LedgerKind = "reversal"
+	LedgerForfeiture LedgerKind = "forfeiture"
+	LedgerOpening    LedgerKind = "opening"
+)
+
+// BalanceDrift describes a user whose cached balance or withdrawn total
+// doesn't match what the ledger says.
+type BalanceDrift struct {
+	UserID          uint   `json:"user_id"`
+	Login           string `json:"login"`
+	Balance         Money  `json:"balance"`
+	LedgerBalance   Money  `json:"ledger_balance"`
+	Withdrawn       Money  `json:"withdrawn"`
+	LedgerWithdrawn Money  `json:"ledger_withdrawn"`
+}
+
+// BalanceEvent is one change of a user's balance together with the balance
+// right after it.
+type BalanceEvent struct {
+	ID        uint                `json:"id"`
+	Kind      LedgerKind          `json:"type"`
+	Ref       *string             `json:"ref,omitempty"`
+	Amount    Money               `json:"amount"`
+	Balance   Money               `json:"balance"`
+	CreatedAt helpers.RFC3339Time `json:"created_at"`
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Money is an amount of points kept in hundredths, so arithmetic on it is
+// exact. It is written to JSON as a plain number and to SQL as a decimal.
+type Money int64
+
+const MoneyScale = 100
+
+// maxMoneyDigits keeps parsed amounts far enough from int64 overflow and
+// still covers every DECIMAL column we have.
+const maxMoneyDigits = 15
+
+const maxMoneyCents = 1e15*MoneyScale - 1
+
+var (
+	ErrMoneyFormat    = errors.New("invalid amount")
+	ErrMoneyPrecision = errors.New("amount has more than two decimal places")
+)
+
+// ParseMoney accepts a decimal with an optional minus sign and at most two
+// fractional digits, e.g. "12", "-0.5" or "729.98".
+func ParseMoney(s string) (Money, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if len(whole) == 0 || len(whole) > maxMoneyDigits || (hasFrac && len(frac) == 0) {
+		return 0, ErrMoneyFormat
+	}
+	if len(frac) > 2 {
+		return 0, ErrMoneyPrecision
+	}
+
+	var cents int64
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, ErrMoneyFormat
+		}
+		cents = cents*10 + int64(r-'0')
+	}
+
+	for i := len(frac); i < 2; i++ {
+		cents *= 10
+	}
+
+	if neg {
+		cents = -cents
+	}
+
+	return Money(cents), nil
+}
+
+// MustParseMoney is ParseMoney for constants known to be valid.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(fmt.Sprintf("models: cannot parse money %q: %v", s, err))
+	}
+
+	return m
+}
+
+// RoundMoney parses any decimal number, exponents included, and rounds it
+// half away from zero to hundredths. It is for amounts we don't control, like
+// accruals computed by the external accrual system.
+func RoundMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrMoneyFormat
+	}
+
+	r.Mul(r, big.NewRat(MoneyScale, 1))
+
+	// |r| + 1/2, truncated, carries the sign back
+	half := big.NewRat(1, 2)
+	if r.Sign() < 0 {
+		half.Neg(half)
+	}
+	r.Add(r, half)
+
+	cents := new(big.Int).Quo(r.Num(), r.Denom())
+	if !cents.IsInt64() || cents.Int64() > maxMoneyCents || cents.Int64() < -maxMoneyCents {
+		return 0, ErrMoneyFormat
+	}
+
+	return Money(cents.Int64()), nil
+}
+
+// MoneyFromFloat rounds f to the nearest hundredth. It is meant for values
+// computed from rates, not for amounts that must stay exact.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * MoneyScale))
+}
+
+// String formats m with exactly two fractional digits.
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/MoneyScale, cents%MoneyScale)
+}
+
+// MarshalJSON drops trailing fractional zeros so amounts look the same as
+// they did when they were floats: 500, 12.5, 729.98.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strings.TrimSuffix(strings.TrimRight(m.String(), "0"), ".")), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		return fmt.Errorf("%w: amount must be a number", ErrMoneyFormat)
+	}
+
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	var err error
+
+	switch v := src.(type) {
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	case int64:
+		*m = Money(v * MoneyScale)
+	case nil:
+		err = errors.New("cannot scan NULL into Money")
+	default:
+		err = fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	return err
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in    string
+		money Money
+		err   error
+	}{
+		{in: "0", money: 0},
+		{in: "500", money: 50000},
+		{in: "729.98", money: 72998},
+		{in: "12.5", money: 1250},
+		{in: "0.01", money: 1},
+		{in: "-0.5", money: -50},
+		{in: "10.00", money: 1000},
+		{in: "10.001", err: ErrMoneyPrecision},
+		{in: "0.125", err: ErrMoneyPrecision},
+		{in: "", err: ErrMoneyFormat},
+		{in: "-", err: ErrMoneyFormat},
+		{in: "10.", err: ErrMoneyFormat},
+		{in: ".5", err: ErrMoneyFormat},
+		{in: "1e2", err: ErrMoneyFormat},
+		{in: "+1", err: ErrMoneyFormat},
+		{in: "1234567890123456", err: ErrMoneyFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			money, err := ParseMoney(tt.in)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.money, money)
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	for in, out := range map[Money]string{
+		0:      "0",
+		50000:  "500",
+		72998:  "729.98",
+		1250:   "12.5",
+		1:      "0.01",
+		-50:    "-0.5",
+		-10000: "-100",
+	} {
+		b, err := json.Marshal(in)
+		assert.NoError(t, err)
+		assert.Equal(t, out, string(b))
+
+		var back Money
+		assert.NoError(t, json.Unmarshal(b, &back))
+		assert.Equal(t, in, back)
+	}
+
+	var v struct {
+		Sum Money `json:"sum"`
+	}
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"sum":1.005}`), &v), ErrMoneyPrecision)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"sum":"1.00"}`), &v), ErrMoneyFormat)
+}
+
+func TestMoneySQL(t *testing.T) {
+	var m Money
+
+	assert.NoError(t, m.Scan([]byte("123.45")))
+	assert.Equal(t, Money(12345), m)
+
+	assert.NoError(t, m.Scan(int64(7)))
+	assert.Equal(t, Money(700), m)
+
+	assert.Error(t, m.Scan(nil))
+	assert.Error(t, m.Scan(1.5))
+
+	v, err := Money(-1250).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "-12.50", v)
+}
+
+func TestRoundMoney(t *testing.T) {
+	tests := []struct {
+		in    string
+		money Money
+		err   error
+	}{
+		{in: "500", money: 50000},
+		{in: "729.98", money: 72998},
+		{in: "36.499", money: 3650},
+		{in: "36.494", money: 3649},
+		{in: "0.005", money: 1},
+		{in: "-0.005", money: -1},
+		{in: "1e2", money: 10000},
+		{in: "1.2345E1", money: 1235},
+		{in: "abc", err: ErrMoneyFormat},
+		{in: "1e30", err: ErrMoneyFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			money, err := RoundMoney(tt.in)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.money, money)
+		})
+	}
+}
@@ -8,16 +8,26 @@ type OrderStatus string
 
 const (
 	NEW        OrderStatus = "NEW"
+	REGISTERED OrderStatus = "REGISTERED"
 	INVALID    OrderStatus = "INVALID"
 	PROCESSING OrderStatus = "PROCESSING"
 	PROCESSED  OrderStatus = "PROCESSED"
 )
 
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case NEW, REGISTERED, INVALID, PROCESSING, PROCESSED:
+		return true
+	}
+
+	return false
+}
+
 type Order struct {
 	ID         uint                `json:"id"`
 	UserID     uint                `json:"user_id,omitempty"`
 	Number     string              `json:"number"`
 	Status     OrderStatus         `json:"status"`
-	Accrual    *float64            `json:"accrual,omitempty"`
+	Accrual    *Money              `json:"accrual,omitempty"`
 	UploadedAt helpers.RFC3339Time `json:"uploaded_at"`
 }
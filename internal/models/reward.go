@@ -0,0 +1,28 @@
+package models
+
+type RewardType string
+
+const (
+	RewardPercent RewardType = "%"
+	RewardPoints  RewardType = "pt"
+)
+
+// RewardRule rewards matching goods with Reward points, or with Reward percent
+// of their price. Both are exact decimals with at most two fractional digits,
+// so a percent rule of 5.25 is 525 hundredths of a percent.
+type RewardRule struct {
+	ID         uint       `json:"id"`
+	Match      string     `json:"match"`
+	Reward     Money      `json:"reward"`
+	RewardType RewardType `json:"reward_type"`
+}
+
+type Good struct {
+	Description string `json:"description"`
+	Price       Money  `json:"price"`
+}
+
+type RewardOrder struct {
+	Number string `json:"order"`
+	Goods  []Good `json:"goods"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	ID        uint
+	UserID    uint
+	SessionID string
+	ExpiresAt time.Time
+}
@@ -1,9 +1,33 @@
 package models
 
+import (
+	"github.com/vtcaregorodtcev/gophermarket/internal/helpers"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Roles lists every role that can be granted.
+var Roles = []string{RoleAdmin, RoleSupport}
+
 type User struct {
-	ID        uint    `json:"id"`
-	Login     string  `json:"login"`
-	Password  string  `json:"password"`
-	Balance   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	ID        uint     `json:"id"`
+	Login     string   `json:"login"`
+	Password  string   `json:"password"`
+	Balance   Money    `json:"current"`
+	Withdrawn Money    `json:"withdrawn"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// UserSummary is what operators see about a user.
+type UserSummary struct {
+	ID           uint                `json:"id"`
+	Login        string              `json:"login"`
+	Balance      Money               `json:"current"`
+	Withdrawn    Money               `json:"withdrawn"`
+	Roles        []string            `json:"roles"`
+	RegisteredAt helpers.RFC3339Time `json:"registered_at"`
+	Deleted      bool                `json:"deleted"`
 }
@@ -5,7 +5,8 @@ import (
 )
 
 type Withdrawal struct {
+	ID          uint                `json:"-"`
 	OrderNumber string              `json:"order"`
-	Sum         float64             `json:"sum"`
+	Sum         Money               `json:"sum"`
 	ProcessedAt helpers.RFC3339Time `json:"processed_at"`
 }
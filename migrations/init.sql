@@ -7,6 +7,12 @@ CREATE TABLE IF NOT EXISTS users (
     withdrawn DECIMAL(10, 2) NOT NULL DEFAULT 0.00
 );
 
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+
 -- Create the orders table if it doesn't exist
 CREATE TABLE IF NOT EXISTS orders (
     id SERIAL PRIMARY KEY,
@@ -27,6 +33,261 @@ CREATE TABLE IF NOT EXISTS withdrawals (
     FOREIGN KEY (user_id) REFERENCES users (id)
 );
 
+-- Back the paginated order and withdrawal listings of a user
+CREATE INDEX IF NOT EXISTS orders_user_uploaded_idx ON orders (user_id, uploaded_at, id);
+
+CREATE INDEX IF NOT EXISTS withdrawals_user_processed_idx ON withdrawals (user_id, processed_at, id);
+
+-- Create the balance adjustments table if it doesn't exist
+CREATE TABLE IF NOT EXISTS balance_adjustments (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    operator_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    comment TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (operator_id) REFERENCES users (id)
+);
+
+-- Back the paginated adjustment listings of a user
+DROP INDEX IF EXISTS balance_adjustments_user_idx;
+CREATE INDEX IF NOT EXISTS balance_adjustments_user_created_idx ON balance_adjustments (user_id, created_at, id);
+
+-- Create the accrual jobs table if it doesn't exist
+CREATE TABLE IF NOT EXISTS accrual_jobs (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+
+CREATE INDEX IF NOT EXISTS accrual_jobs_pending_idx ON accrual_jobs (next_run_at)
+WHERE
+    completed_at IS NULL;
+
+-- Create the accrual attempts history table if it doesn't exist
+CREATE TABLE IF NOT EXISTS accrual_attempts (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    status VARCHAR(50),
+    accrual DECIMAL(10, 2),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders (id)
+);
+
+CREATE INDEX IF NOT EXISTS accrual_attempts_order_idx ON accrual_attempts (order_id);
+
+-- Create the reward rules table if it doesn't exist
+CREATE TABLE IF NOT EXISTS reward_rules (
+    id SERIAL PRIMARY KEY,
+    match VARCHAR(255) NOT NULL UNIQUE,
+    reward DECIMAL(10, 2) NOT NULL,
+    reward_type VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create the reward orders table if it doesn't exist
+CREATE TABLE IF NOT EXISTS reward_orders (
+    id SERIAL PRIMARY KEY,
+    number VARCHAR(255) NOT NULL UNIQUE,
+    goods JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Logins are case-insensitive. Accounts registered before that may clash only
+-- by case; they have to be merged or renamed by hand, so name them instead of
+-- failing on the index with a bare unique violation.
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    IF to_regclass('users_login_lower_idx') IS NOT NULL THEN
+        RETURN;
+    END IF;
+
+    SELECT
+        string_agg(logins, '; ')
+    INTO
+        conflicts
+    FROM
+        (
+            SELECT
+                string_agg(login, ', ' ORDER BY id) AS logins
+            FROM
+                users
+            GROUP BY
+                LOWER(login)
+            HAVING
+                COUNT(*) > 1
+        ) d;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'cannot make logins case-insensitive, rename the conflicting logins first: %', conflicts;
+    END IF;
+END;
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_idx ON users (LOWER(login));
+
+-- Create the refresh tokens table if it doesn't exist
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    session_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_idx ON refresh_tokens (session_id);
+
+-- Create the failed login counters table if it doesn't exist
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(512) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_last_failure_idx ON login_attempts (last_failure_at);
+
+-- Create the login lockouts audit table if it doesn't exist
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL,
+    subject VARCHAR(512) NOT NULL,
+    failures INT NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create the points ledger if it doesn't exist. Every transaction is a set
+-- of entries sharing txn_id whose amounts sum up to zero: the user account
+-- on one side and a system account on the other.
+CREATE SEQUENCE IF NOT EXISTS ledger_txn_seq;
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    txn_id BIGINT NOT NULL,
+    account VARCHAR(64) NOT NULL,
+    user_id INT,
+    kind VARCHAR(32) NOT NULL,
+    ref VARCHAR(255),
+    amount DECIMAL(12, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_txn_idx ON ledger_entries (txn_id);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_user_idx ON ledger_entries (user_id, created_at);
+
+-- Backs the running balance of the balance history
+CREATE INDEX IF NOT EXISTS ledger_entries_user_id_idx ON ledger_entries (user_id, id);
+
+CREATE OR REPLACE FUNCTION ledger_entries_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_immutable ON ledger_entries;
+
+CREATE TRIGGER ledger_entries_immutable BEFORE UPDATE OR DELETE OR TRUNCATE ON ledger_entries
+FOR EACH STATEMENT EXECUTE FUNCTION ledger_entries_immutable();
+
+CREATE OR REPLACE FUNCTION ledger_entries_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM ledger_entries WHERE txn_id = NEW.txn_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger transaction % does not balance', NEW.txn_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced AFTER INSERT ON ledger_entries
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION ledger_entries_balanced();
+
+-- Open the ledger of users whose balances predate it
+WITH opening AS (
+    SELECT
+        id,
+        balance,
+        withdrawn,
+        nextval('ledger_txn_seq') AS txn_id
+    FROM
+        users u
+    WHERE
+        (balance <> 0 OR withdrawn <> 0)
+        AND NOT EXISTS (
+            SELECT
+                1
+            FROM
+                ledger_entries l
+            WHERE
+                l.user_id = u.id
+        )
+)
+INSERT INTO
+    ledger_entries (txn_id, account, user_id, kind, amount)
+SELECT
+    txn_id,
+    'user:' || id,
+    id,
+    'opening',
+    balance + withdrawn
+FROM
+    opening
+UNION
+ALL
+SELECT
+    txn_id,
+    'system:opening',
+    NULL,
+    'opening',
+    -(balance + withdrawn)
+FROM
+    opening
+UNION
+ALL
+SELECT
+    txn_id,
+    'user:' || id,
+    id,
+    'withdrawal',
+    -withdrawn
+FROM
+    opening
+WHERE
+    withdrawn <> 0
+UNION
+ALL
+SELECT
+    txn_id,
+    'system:withdrawals',
+    NULL,
+    'withdrawal',
+    withdrawn
+FROM
+    opening
+WHERE
+    withdrawn <> 0;
+
 -- Insert a couple of users
 INSERT INTO
     users (login, password)